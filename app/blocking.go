@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Blocking commands park the client until one of the keys it waits on can
+// serve it. Commands that may unblock clients signal the keys they touched,
+// and once the command is over those keys are handed to the clients blocked
+// on them in the order they blocked.
+
+// serveFunc tries to complete a blocked command using key. It runs with the
+// store lock held and reports false if key cannot serve the client yet.
+type serveFunc func(db database, key string) ([]byte, bool)
+
+type blockedClient struct {
+	db    int
+	keys  []string
+	serve serveFunc
+	reply chan []byte
+}
+
+type readyKey struct {
+	db  int
+	key string
+}
+
+func initBlocking() {
+	status.blockedClients = make(map[int]map[string][]*blockedClient)
+	status.readyKeys = make([]readyKey, 0)
+}
+
+// parseTimeout parses a timeout in seconds, zero meaning no timeout.
+func parseTimeout(s string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, ErrRespTimeoutNotFloat
+	}
+
+	if seconds < 0 {
+		return 0, ErrRespTimeoutNegative
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// signalKeyAsReady records that key may now be able to serve blocked clients.
+func signalKeyAsReady(db database, key string) {
+	if len(status.blockedClients[db.id][key]) == 0 {
+		return
+	}
+
+	for _, ready := range status.readyKeys {
+		if ready.db == db.id && ready.key == key {
+			return
+		}
+	}
+
+	status.readyKeys = append(status.readyKeys, readyKey{db: db.id, key: key})
+}
+
+// serveBlockedClients hands every ready key to the clients blocked on it,
+// oldest first. Serving a client can make other keys ready (BLMOVE pushes to
+// its destination), so it runs until no key is left.
+// It must be called with the store lock held.
+func serveBlockedClients() {
+	for len(status.readyKeys) > 0 {
+		readyKeys := status.readyKeys
+		status.readyKeys = make([]readyKey, 0)
+
+		for _, ready := range readyKeys {
+			// Copy, as unblocking a client modifies the queue
+			clients := append([]*blockedClient(nil), status.blockedClients[ready.db][ready.key]...)
+
+			for _, client := range clients {
+				reply, ok := client.serve(status.databases[ready.db], ready.key)
+				if !ok {
+					continue
+				}
+
+				unblockClient(client)
+				client.reply <- reply
+			}
+		}
+	}
+}
+
+func unblockClient(client *blockedClient) {
+	for _, key := range client.keys {
+		queue := status.blockedClients[client.db][key]
+
+		for i, c := range queue {
+			if c == client {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+
+		if len(queue) == 0 {
+			delete(status.blockedClients[client.db], key)
+		} else {
+			status.blockedClients[client.db][key] = queue
+		}
+	}
+}
+
+// blockForKeys parks the calling client until one of `keys` serves it, and
+// returns the reply built by `serve`. It returns nil once `timeout` expires,
+// a zero timeout blocking forever, or once the client disconnects.
+// It must be called with the store lock held. The lock is released while
+// waiting and held again when blockForKeys returns.
+func blockForKeys(db database, keys []string, timeout time.Duration, serve serveFunc) []byte {
+	closed := status.clientClosed
+	client := &blockedClient{
+		db:    db.id,
+		keys:  make([]string, 0, len(keys)),
+		serve: serve,
+		reply: make(chan []byte, 1),
+	}
+
+	if _, ok := status.blockedClients[db.id]; !ok {
+		status.blockedClients[db.id] = make(map[string][]*blockedClient)
+	}
+
+	for _, key := range keys {
+		if containsString(client.keys, key) {
+			continue
+		}
+
+		client.keys = append(client.keys, key)
+		status.blockedClients[db.id][key] = append(status.blockedClients[db.id][key], client)
+	}
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	status.storeLock.Unlock()
+
+	select {
+	case reply := <-client.reply:
+		status.storeLock.Lock()
+		return reply
+	case <-timeoutC:
+	case <-closed:
+	}
+
+	status.storeLock.Lock()
+
+	// The client may have been served while we were waiting for the lock
+	select {
+	case reply := <-client.reply:
+		return reply
+	default:
+	}
+
+	unblockClient(client)
+	return nil
+}
+
+func containsString(a []string, s string) bool {
+	for _, e := range a {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func setupTestStore() database {
+	status.databases = map[int]database{0: newDatabase(0)}
+	status.databaseCount = defaultDatabaseCount
+	status.replicationDB = -1
+	status.replicas = make(map[string]*replica)
+	initBlocking()
+
+	return status.databases[0]
+}
+
+// runLocked runs f as a command would, with the store lock held and blocked
+// clients served afterwards.
+func runLocked(f func() ([]byte, error)) ([]byte, error) {
+	status.storeLock.Lock()
+	defer status.storeLock.Unlock()
+
+	response, err := f()
+	serveBlockedClients()
+
+	return response, err
+}
+
+func waitForBlockedClients(t *testing.T, key string, n int) {
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		status.storeLock.Lock()
+		blocked := len(status.blockedClients[0][key])
+		status.storeLock.Unlock()
+
+		if blocked == n {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("expected %d clients blocked on %s", n, key)
+}
+
+func TestBlockedClientsAreServedInOrder(t *testing.T) {
+	db := setupTestStore()
+	replies := make([]chan string, 3)
+
+	for i := range replies {
+		replies[i] = make(chan string, 1)
+
+		go func(reply chan string) {
+			response, _ := runLocked(func() ([]byte, error) {
+				return blpop(db, []string{"queue", "0"}, true)
+			})
+			reply <- string(response)
+		}(replies[i])
+
+		waitForBlockedClients(t, "queue", i+1)
+	}
+
+	runLocked(func() ([]byte, error) {
+		return rpush(db, []string{"queue", "a", "b"})
+	})
+
+	expected := []string{
+		string(encodeRespStringArray([]string{"queue", "a"})),
+		string(encodeRespStringArray([]string{"queue", "b"})),
+	}
+
+	for i, want := range expected {
+		select {
+		case got := <-replies[i]:
+			if got != want {
+				t.Errorf("client %d got %q, want %q", i, got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("client %d was not served", i)
+		}
+	}
+
+	waitForBlockedClients(t, "queue", 1)
+}
+
+func TestBlockingPopTimeout(t *testing.T) {
+	db := setupTestStore()
+
+	response, err := runLocked(func() ([]byte, error) {
+		return brpop(db, []string{"queue", "0.01"}, true)
+	})
+	if err != nil {
+		t.Fatalf("brpop() error = %v", err)
+	}
+
+	if string(response) != "*-1\r\n" {
+		t.Errorf("brpop() = %q, want null array", response)
+	}
+
+	if len(status.blockedClients[0]["queue"]) != 0 {
+		t.Errorf("client still blocked after timeout")
+	}
+}
+
+func TestBlockingPopInTransactionDoesNotBlock(t *testing.T) {
+	db := setupTestStore()
+
+	response, err := runLocked(func() ([]byte, error) {
+		return blpop(db, []string{"queue", "0"}, false)
+	})
+	if err != nil {
+		t.Fatalf("blpop() error = %v", err)
+	}
+
+	if string(response) != "*-1\r\n" {
+		t.Errorf("blpop() = %q, want null array", response)
+	}
+}
+
+func TestBlockingSortedSetPopIsServedByZadd(t *testing.T) {
+	db := setupTestStore()
+	reply := make(chan string, 1)
+
+	go func() {
+		response, _ := runLocked(func() ([]byte, error) {
+			return bzpop(db, []string{"scores", "0"}, false, true)
+		})
+		reply <- string(response)
+	}()
+
+	waitForBlockedClients(t, "scores", 1)
+
+	runLocked(func() ([]byte, error) {
+		return zadd(db, []string{"scores", "2", "b", "1", "a"})
+	})
+
+	want := string(encodeRespStringArray([]string{"scores", "a", "1"}))
+
+	select {
+	case got := <-reply:
+		if got != want {
+			t.Errorf("bzpopmin got %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("client was not served")
+	}
+}
+
+func TestDisconnectedClientsAreUnblocked(t *testing.T) {
+	db := setupTestStore()
+	closed := make(chan struct{})
+	reply := make(chan string, 1)
+
+	go func() {
+		response, _ := runLocked(func() ([]byte, error) {
+			status.clientClosed = closed
+			defer func() { status.clientClosed = nil }()
+
+			return blpop(db, []string{"queue", "0"}, true)
+		})
+		reply <- string(response)
+	}()
+
+	waitForBlockedClients(t, "queue", 1)
+	close(closed)
+
+	select {
+	case got := <-reply:
+		if got != "*-1\r\n" {
+			t.Errorf("blpop of a disconnected client = %q, want a null array", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("disconnected client is still blocked")
+	}
+
+	// The element is left for the next client instead of being popped for
+	// the disconnected one
+	runLocked(func() ([]byte, error) {
+		return rpush(db, []string{"queue", "a"})
+	})
+
+	if got, _ := llen(db, []string{"queue"}); string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("llen after the push = %q, want 1", got)
+	}
+}
@@ -3,9 +3,9 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 type command int
@@ -31,12 +31,151 @@ const (
 	XRANGE
 	XREAD
 	INCR
+	INCRBY
+	DECR
+	DECRBY
+	INCRBYFLOAT
 	MULTI
 	EXEC
 	QUEUE
 	DISCARD
+	LPUSH
+	RPUSH
+	LPOP
+	RPOP
+	LRANGE
+	LLEN
+	LINDEX
+	LSET
+	LREM
+	LTRIM
+	LINSERT
+	LPOS
+	LMOVE
+	LMPOP
+	BLPOP
+	BRPOP
+	BLMOVE
+	BLMPOP
+	HSET
+	HSETNX
+	HGET
+	HMGET
+	HGETALL
+	HDEL
+	HEXISTS
+	HINCRBY
+	HINCRBYFLOAT
+	HKEYS
+	HVALS
+	HLEN
+	HSCAN
+	HEXPIRE
+	HPEXPIRE
+	HEXPIREAT
+	HPEXPIREAT
+	HTTL
+	HPTTL
+	HEXPIRETIME
+	HPEXPIRETIME
+	HPERSIST
+	SADD
+	SREM
+	SMEMBERS
+	SISMEMBER
+	SMISMEMBER
+	SCARD
+	SPOP
+	SRANDMEMBER
+	SINTER
+	SUNION
+	SDIFF
+	SINTERSTORE
+	SUNIONSTORE
+	SDIFFSTORE
+	SINTERCARD
+	SMOVE
+	ZADD
+	ZINCRBY
+	ZREM
+	ZCARD
+	ZSCORE
+	ZRANK
+	ZREVRANK
+	ZCOUNT
+	ZRANGE
+	ZUNIONSTORE
+	ZINTERSTORE
+	ZDIFFSTORE
+	ZPOPMIN
+	ZPOPMAX
+	BZPOPMIN
+	BZPOPMAX
+	APPEND
+	STRLEN
+	GETRANGE
+	SETRANGE
+	GETDEL
+	GETEX
+	GETSET
+	LCS
+	MSET
+	MSETNX
+	MGET
+	EXPIRE
+	PEXPIRE
+	EXPIREAT
+	PEXPIREAT
+	TTL
+	PTTL
+	EXPIRETIME
+	PEXPIRETIME
+	PERSIST
+	SCAN
+	SSCAN
+	ZSCAN
+	EXISTS
+	RENAME
+	RENAMENX
+	COPY
+	MOVE
+	RANDOMKEY
+	DBSIZE
+	TOUCH
+	FLUSHDB
+	FLUSHALL
+	SWAPDB
+	XGROUP
+	XREADGROUP
+	XACK
+	XPENDING
+	XCLAIM
+	XAUTOCLAIM
+	XTRIM
+	XDEL
+	XLEN
+	XREVRANGE
+	XINFO
 )
 
+// isWriteCommand reports whether a command modifies the dataset, in which
+// case it has to be forwarded to replicas.
+func isWriteCommand(command command) bool {
+	switch command {
+	case DEL, RENAME, RENAMENX, COPY, MOVE, FLUSHDB, FLUSHALL, SWAPDB,
+		APPEND, SETRANGE, GETDEL, GETSET, MSET, MSETNX, PERSIST,
+		INCR, INCRBY, DECR, DECRBY,
+		LPUSH, RPUSH, LPOP, RPOP, LSET, LREM, LTRIM, LINSERT, LMOVE, LMPOP,
+		HSET, HSETNX, HDEL, HINCRBY, HPERSIST,
+		SADD, SREM, SMOVE, SINTERSTORE, SUNIONSTORE, SDIFFSTORE,
+		ZADD, ZINCRBY, ZREM, ZUNIONSTORE, ZINTERSTORE, ZDIFFSTORE, ZPOPMIN, ZPOPMAX,
+		XGROUP, XACK, XDEL:
+		return true
+	}
+
+	return false
+}
+
 func discard(multi []query) ([]byte, error) {
 	if multi == nil {
 		return nil, fmt.Errorf("%w DISCARD without MULTI\r\n", ErrRespSimpleError)
@@ -54,16 +193,34 @@ func execFunc(conn *connection, multi []query) ([]byte, error) {
 		return []byte("*0\r\n"), nil
 	}
 
+	conn.inTransaction = true
+	status.inExec = true
+	defer func() {
+		conn.inTransaction = false
+		status.inExec = false
+		status.execOpenedInRepl = false
+	}()
+
 	allResponses := make([][]byte, 0)
 	for _, query := range multi {
-		response, _, err := execute(conn, &query, nil)
-		if err != nil && errors.Is(err, ErrRespSimpleError) {
+		response, command, err := execute(conn, &query, nil)
+		if err != nil && isRespError(err) {
 			response = []byte(err.Error())
 		}
 
+		// Replicas get the writes of the transaction, wrapped in MULTI and
+		// EXEC so they apply them at once too
+		if err == nil && isWriteCommand(command) {
+			replicate(conn.db, query.raw())
+		}
+
 		allResponses = append(allResponses, response)
 	}
 
+	if status.execOpenedInRepl {
+		replicate(status.replicationDB, encodeRespStringArray([]string{"EXEC"}))
+	}
+
 	return encodeRespArray(allResponses), nil
 }
 
@@ -86,20 +243,31 @@ func echo(args []string) []byte {
 func info(args []string) []byte {
 	requestedSections := 0
 	replicationRequested := false
+	statsRequested := false
 
 	for _, section := range args {
 		requestedSections += 1
 
 		if section == "replication" {
 			replicationRequested = true
+		} else if section == "stats" {
+			statsRequested = true
 		} else if section == "all" {
 			replicationRequested = true
+			statsRequested = true
 		}
 	}
 
 	// no section requested or "all" section requested should result in
 	// every supported sections to be printed
-	if replicationRequested || requestedSections == 0 {
+	if requestedSections == 0 {
+		replicationRequested = true
+		statsRequested = true
+	}
+
+	sections := make([]string, 0)
+
+	if replicationRequested {
 		var role string
 
 		if status.replicaof != "" {
@@ -108,18 +276,32 @@ func info(args []string) []byte {
 			role = "master"
 		}
 
-		response := fmt.Sprintf(`# Replication
+		sections = append(sections, fmt.Sprintf(`# Replication
 role:%s
 master_replid:%s
 master_repl_offset:%d`,
 			role,
 			status.replId,
-			status.replOffset)
+			status.replOffset))
+	}
+
+	if statsRequested {
+		stats := status.expireStats
 
-		return encodeRespBulkString(response)
+		sections = append(sections, fmt.Sprintf(`# Stats
+expired_keys:%d
+expired_subkeys:%d
+expired_stale_perc:%.2f
+expired_time_cap_reached_count:%d
+expire_cycle_cpu_milliseconds:%d`,
+			stats.expiredKeys,
+			stats.expiredSubkeys,
+			stats.stalePercentage*100,
+			stats.timeCapReachedCount,
+			stats.cycleTime.Milliseconds()))
 	}
 
-	panic("Unreachable code")
+	return encodeRespBulkString(strings.Join(sections, "\n\n"))
 }
 
 func execute(conn *connection, query *query, multi []query) ([]byte, command, error) {
@@ -145,6 +327,8 @@ func execute(conn *connection, query *query, multi []query) ([]byte, command, er
 
 	command := array[0]
 	args := array[1:]
+	// The selected database was validated by SELECT
+	db, _ := getDatabase(conn.db)
 
 	if multi != nil &&
 		!strings.EqualFold(command, "EXEC") &&
@@ -164,12 +348,12 @@ func execute(conn *connection, query *query, multi []query) ([]byte, command, er
 	}
 
 	if strings.EqualFold(command, "SET") {
-		response, err := set(args)
+		response, err := set(db, args)
 		return response, SET, err
 	}
 
 	if strings.EqualFold(command, "GET") {
-		response, err := get(args)
+		response, err := get(db, args)
 		return response, GET, err
 	}
 
@@ -189,13 +373,13 @@ func execute(conn *connection, query *query, multi []query) ([]byte, command, er
 	}
 
 	if strings.EqualFold(command, "WAIT") {
-		response := wait(args)
-		return response, WAIT, nil
+		response, err := wait(args, !conn.inTransaction)
+		return response, WAIT, err
 	}
 
 	if strings.EqualFold(command, "SELECT") {
-		response := selectFunc(args)
-		return response, SELECT, nil
+		response, err := selectFunc(conn, args)
+		return response, SELECT, err
 	}
 
 	if strings.EqualFold(command, "CONFIG") {
@@ -204,7 +388,7 @@ func execute(conn *connection, query *query, multi []query) ([]byte, command, er
 	}
 
 	if strings.EqualFold(command, "KEYS") {
-		response, err := keys(args)
+		response, err := keys(db, args)
 		return response, KEYS, err
 	}
 
@@ -214,35 +398,640 @@ func execute(conn *connection, query *query, multi []query) ([]byte, command, er
 	}
 
 	if strings.EqualFold(command, "DEL") {
-		response, err := del(args)
+		response, err := del(db, args)
 		return response, DEL, err
 	}
 
 	if strings.EqualFold(command, "TYPE") {
-		response, err := typeFunc(args)
+		response, err := typeFunc(db, args)
 		return response, TYPE, err
 	}
 
 	if strings.EqualFold(command, "XADD") {
-		response, err := xadd(args)
+		response, err := xadd(db, args)
 		return response, XADD, err
 	}
 
 	if strings.EqualFold(command, "xrange") {
-		response, err := xrange(args)
+		response, err := xrange(db, args, false)
 		return response, XRANGE, err
 	}
 
+	if strings.EqualFold(command, "xrevrange") {
+		response, err := xrange(db, args, true)
+		return response, XREVRANGE, err
+	}
+
 	if strings.EqualFold(command, "xread") {
-		response, err := xread(args)
+		response, err := xread(db, args, !conn.inTransaction)
 		return response, XREAD, err
 	}
 
 	if strings.EqualFold(command, "incr") {
-		response, err := incr(args)
+		response, err := incr(db, args)
 		return response, INCR, err
 	}
 
+	if strings.EqualFold(command, "INCRBY") {
+		response, err := incrby(db, args)
+		return response, INCRBY, err
+	}
+
+	if strings.EqualFold(command, "DECR") {
+		response, err := decr(db, args)
+		return response, DECR, err
+	}
+
+	if strings.EqualFold(command, "DECRBY") {
+		response, err := decrby(db, args)
+		return response, DECRBY, err
+	}
+
+	if strings.EqualFold(command, "INCRBYFLOAT") {
+		response, err := incrbyfloat(db, args)
+		return response, INCRBYFLOAT, err
+	}
+
+	if strings.EqualFold(command, "LPUSH") {
+		response, err := lpush(db, args)
+		return response, LPUSH, err
+	}
+
+	if strings.EqualFold(command, "RPUSH") {
+		response, err := rpush(db, args)
+		return response, RPUSH, err
+	}
+
+	if strings.EqualFold(command, "LPOP") {
+		response, err := lpop(db, args)
+		return response, LPOP, err
+	}
+
+	if strings.EqualFold(command, "RPOP") {
+		response, err := rpop(db, args)
+		return response, RPOP, err
+	}
+
+	if strings.EqualFold(command, "LRANGE") {
+		response, err := lrange(db, args)
+		return response, LRANGE, err
+	}
+
+	if strings.EqualFold(command, "LLEN") {
+		response, err := llen(db, args)
+		return response, LLEN, err
+	}
+
+	if strings.EqualFold(command, "LINDEX") {
+		response, err := lindex(db, args)
+		return response, LINDEX, err
+	}
+
+	if strings.EqualFold(command, "LSET") {
+		response, err := lset(db, args)
+		return response, LSET, err
+	}
+
+	if strings.EqualFold(command, "LREM") {
+		response, err := lrem(db, args)
+		return response, LREM, err
+	}
+
+	if strings.EqualFold(command, "LTRIM") {
+		response, err := ltrim(db, args)
+		return response, LTRIM, err
+	}
+
+	if strings.EqualFold(command, "LPOS") {
+		response, err := lpos(db, args)
+		return response, LPOS, err
+	}
+
+	if strings.EqualFold(command, "LINSERT") {
+		response, err := linsert(db, args)
+		return response, LINSERT, err
+	}
+
+	if strings.EqualFold(command, "LMOVE") {
+		response, err := lmove(db, args)
+		return response, LMOVE, err
+	}
+
+	if strings.EqualFold(command, "LMPOP") {
+		response, err := lmpop(db, args)
+		return response, LMPOP, err
+	}
+
+	if strings.EqualFold(command, "BLPOP") {
+		response, err := blpop(db, args, !conn.inTransaction)
+		return response, BLPOP, err
+	}
+
+	if strings.EqualFold(command, "BRPOP") {
+		response, err := brpop(db, args, !conn.inTransaction)
+		return response, BRPOP, err
+	}
+
+	if strings.EqualFold(command, "BLMOVE") {
+		response, err := blmove(db, args, !conn.inTransaction)
+		return response, BLMOVE, err
+	}
+
+	if strings.EqualFold(command, "BLMPOP") {
+		response, err := blmpop(db, args, !conn.inTransaction)
+		return response, BLMPOP, err
+	}
+
+	if strings.EqualFold(command, "HSET") {
+		response, err := hset(db, args)
+		return response, HSET, err
+	}
+
+	if strings.EqualFold(command, "HSETNX") {
+		response, err := hsetnx(db, args)
+		return response, HSETNX, err
+	}
+
+	if strings.EqualFold(command, "HGET") {
+		response, err := hget(db, args)
+		return response, HGET, err
+	}
+
+	if strings.EqualFold(command, "HMGET") {
+		response, err := hmget(db, args)
+		return response, HMGET, err
+	}
+
+	if strings.EqualFold(command, "HGETALL") {
+		response, err := hgetall(db, args)
+		return response, HGETALL, err
+	}
+
+	if strings.EqualFold(command, "HDEL") {
+		response, err := hdel(db, args)
+		return response, HDEL, err
+	}
+
+	if strings.EqualFold(command, "HEXISTS") {
+		response, err := hexists(db, args)
+		return response, HEXISTS, err
+	}
+
+	if strings.EqualFold(command, "HINCRBY") {
+		response, err := hincrby(db, args)
+		return response, HINCRBY, err
+	}
+
+	if strings.EqualFold(command, "HINCRBYFLOAT") {
+		response, err := hincrbyfloat(db, args)
+		return response, HINCRBYFLOAT, err
+	}
+
+	if strings.EqualFold(command, "HKEYS") {
+		response, err := hkeys(db, args)
+		return response, HKEYS, err
+	}
+
+	if strings.EqualFold(command, "HVALS") {
+		response, err := hvals(db, args)
+		return response, HVALS, err
+	}
+
+	if strings.EqualFold(command, "HLEN") {
+		response, err := hlen(db, args)
+		return response, HLEN, err
+	}
+
+	if strings.EqualFold(command, "HSCAN") {
+		response, err := hscan(db, args)
+		return response, HSCAN, err
+	}
+
+	if strings.EqualFold(command, "HEXPIRE") {
+		response, err := hexpire(db, args, "hexpire", time.Second, false)
+		return response, HEXPIRE, err
+	}
+
+	if strings.EqualFold(command, "HPEXPIRE") {
+		response, err := hexpire(db, args, "hpexpire", time.Millisecond, false)
+		return response, HPEXPIRE, err
+	}
+
+	if strings.EqualFold(command, "HEXPIREAT") {
+		response, err := hexpire(db, args, "hexpireat", time.Second, true)
+		return response, HEXPIREAT, err
+	}
+
+	if strings.EqualFold(command, "HPEXPIREAT") {
+		response, err := hexpire(db, args, "hpexpireat", time.Millisecond, true)
+		return response, HPEXPIREAT, err
+	}
+
+	if strings.EqualFold(command, "HTTL") {
+		response, err := httl(db, args, time.Second, false)
+		return response, HTTL, err
+	}
+
+	if strings.EqualFold(command, "HPTTL") {
+		response, err := httl(db, args, time.Millisecond, false)
+		return response, HPTTL, err
+	}
+
+	if strings.EqualFold(command, "HEXPIRETIME") {
+		response, err := httl(db, args, time.Second, true)
+		return response, HEXPIRETIME, err
+	}
+
+	if strings.EqualFold(command, "HPEXPIRETIME") {
+		response, err := httl(db, args, time.Millisecond, true)
+		return response, HPEXPIRETIME, err
+	}
+
+	if strings.EqualFold(command, "HPERSIST") {
+		response, err := hpersist(db, args)
+		return response, HPERSIST, err
+	}
+
+	if strings.EqualFold(command, "SADD") {
+		response, err := sadd(db, args)
+		return response, SADD, err
+	}
+
+	if strings.EqualFold(command, "SREM") {
+		response, err := srem(db, args)
+		return response, SREM, err
+	}
+
+	if strings.EqualFold(command, "SMEMBERS") {
+		response, err := smembers(db, args)
+		return response, SMEMBERS, err
+	}
+
+	if strings.EqualFold(command, "SISMEMBER") {
+		response, err := sismember(db, args)
+		return response, SISMEMBER, err
+	}
+
+	if strings.EqualFold(command, "SMISMEMBER") {
+		response, err := smismember(db, args)
+		return response, SMISMEMBER, err
+	}
+
+	if strings.EqualFold(command, "SCARD") {
+		response, err := scard(db, args)
+		return response, SCARD, err
+	}
+
+	if strings.EqualFold(command, "SPOP") {
+		response, err := spop(db, args)
+		return response, SPOP, err
+	}
+
+	if strings.EqualFold(command, "SRANDMEMBER") {
+		response, err := srandmember(db, args)
+		return response, SRANDMEMBER, err
+	}
+
+	if strings.EqualFold(command, "SINTER") {
+		response, err := sinter(db, args)
+		return response, SINTER, err
+	}
+
+	if strings.EqualFold(command, "SUNION") {
+		response, err := sunion(db, args)
+		return response, SUNION, err
+	}
+
+	if strings.EqualFold(command, "SDIFF") {
+		response, err := sdiff(db, args)
+		return response, SDIFF, err
+	}
+
+	if strings.EqualFold(command, "SINTERSTORE") {
+		response, err := sinterstore(db, args)
+		return response, SINTERSTORE, err
+	}
+
+	if strings.EqualFold(command, "SUNIONSTORE") {
+		response, err := sunionstore(db, args)
+		return response, SUNIONSTORE, err
+	}
+
+	if strings.EqualFold(command, "SDIFFSTORE") {
+		response, err := sdiffstore(db, args)
+		return response, SDIFFSTORE, err
+	}
+
+	if strings.EqualFold(command, "SINTERCARD") {
+		response, err := sintercard(db, args)
+		return response, SINTERCARD, err
+	}
+
+	if strings.EqualFold(command, "SMOVE") {
+		response, err := smove(db, args)
+		return response, SMOVE, err
+	}
+
+	if strings.EqualFold(command, "ZADD") {
+		response, err := zadd(db, args)
+		return response, ZADD, err
+	}
+
+	if strings.EqualFold(command, "ZINCRBY") {
+		response, err := zincrby(db, args)
+		return response, ZINCRBY, err
+	}
+
+	if strings.EqualFold(command, "ZREM") {
+		response, err := zrem(db, args)
+		return response, ZREM, err
+	}
+
+	if strings.EqualFold(command, "ZCARD") {
+		response, err := zcard(db, args)
+		return response, ZCARD, err
+	}
+
+	if strings.EqualFold(command, "ZSCORE") {
+		response, err := zscore(db, args)
+		return response, ZSCORE, err
+	}
+
+	if strings.EqualFold(command, "ZRANK") {
+		response, err := zrank(db, args, false)
+		return response, ZRANK, err
+	}
+
+	if strings.EqualFold(command, "ZREVRANK") {
+		response, err := zrank(db, args, true)
+		return response, ZREVRANK, err
+	}
+
+	if strings.EqualFold(command, "ZCOUNT") {
+		response, err := zcount(db, args)
+		return response, ZCOUNT, err
+	}
+
+	if strings.EqualFold(command, "ZRANGE") {
+		response, err := zrange(db, args)
+		return response, ZRANGE, err
+	}
+
+	if strings.EqualFold(command, "ZUNIONSTORE") {
+		response, err := zunionstore(db, args)
+		return response, ZUNIONSTORE, err
+	}
+
+	if strings.EqualFold(command, "ZINTERSTORE") {
+		response, err := zinterstore(db, args)
+		return response, ZINTERSTORE, err
+	}
+
+	if strings.EqualFold(command, "ZDIFFSTORE") {
+		response, err := zdiffstore(db, args)
+		return response, ZDIFFSTORE, err
+	}
+
+	if strings.EqualFold(command, "ZPOPMIN") {
+		response, err := zpop(db, args, false)
+		return response, ZPOPMIN, err
+	}
+
+	if strings.EqualFold(command, "ZPOPMAX") {
+		response, err := zpop(db, args, true)
+		return response, ZPOPMAX, err
+	}
+
+	if strings.EqualFold(command, "BZPOPMIN") {
+		response, err := bzpop(db, args, false, !conn.inTransaction)
+		return response, BZPOPMIN, err
+	}
+
+	if strings.EqualFold(command, "BZPOPMAX") {
+		response, err := bzpop(db, args, true, !conn.inTransaction)
+		return response, BZPOPMAX, err
+	}
+
+	if strings.EqualFold(command, "APPEND") {
+		response, err := appendFunc(db, args)
+		return response, APPEND, err
+	}
+
+	if strings.EqualFold(command, "STRLEN") {
+		response, err := strlen(db, args)
+		return response, STRLEN, err
+	}
+
+	if strings.EqualFold(command, "GETRANGE") {
+		response, err := getrange(db, args)
+		return response, GETRANGE, err
+	}
+
+	if strings.EqualFold(command, "SETRANGE") {
+		response, err := setrange(db, args)
+		return response, SETRANGE, err
+	}
+
+	if strings.EqualFold(command, "GETDEL") {
+		response, err := getdel(db, args)
+		return response, GETDEL, err
+	}
+
+	if strings.EqualFold(command, "GETEX") {
+		response, err := getex(db, args)
+		return response, GETEX, err
+	}
+
+	if strings.EqualFold(command, "GETSET") {
+		response, err := getset(db, args)
+		return response, GETSET, err
+	}
+
+	if strings.EqualFold(command, "LCS") {
+		response, err := lcs(db, args)
+		return response, LCS, err
+	}
+
+	if strings.EqualFold(command, "MSET") {
+		response, err := mset(db, args)
+		return response, MSET, err
+	}
+
+	if strings.EqualFold(command, "MSETNX") {
+		response, err := msetnx(db, args)
+		return response, MSETNX, err
+	}
+
+	if strings.EqualFold(command, "MGET") {
+		response, err := mget(db, args)
+		return response, MGET, err
+	}
+
+	if strings.EqualFold(command, "EXPIRE") {
+		response, err := expire(db, args, "expire", time.Second, false)
+		return response, EXPIRE, err
+	}
+
+	if strings.EqualFold(command, "PEXPIRE") {
+		response, err := expire(db, args, "pexpire", time.Millisecond, false)
+		return response, PEXPIRE, err
+	}
+
+	if strings.EqualFold(command, "EXPIREAT") {
+		response, err := expire(db, args, "expireat", time.Second, true)
+		return response, EXPIREAT, err
+	}
+
+	if strings.EqualFold(command, "PEXPIREAT") {
+		response, err := expire(db, args, "pexpireat", time.Millisecond, true)
+		return response, PEXPIREAT, err
+	}
+
+	if strings.EqualFold(command, "TTL") {
+		response, err := ttl(db, args, time.Second, false)
+		return response, TTL, err
+	}
+
+	if strings.EqualFold(command, "PTTL") {
+		response, err := ttl(db, args, time.Millisecond, false)
+		return response, PTTL, err
+	}
+
+	if strings.EqualFold(command, "EXPIRETIME") {
+		response, err := ttl(db, args, time.Second, true)
+		return response, EXPIRETIME, err
+	}
+
+	if strings.EqualFold(command, "PEXPIRETIME") {
+		response, err := ttl(db, args, time.Millisecond, true)
+		return response, PEXPIRETIME, err
+	}
+
+	if strings.EqualFold(command, "PERSIST") {
+		response, err := persist(db, args)
+		return response, PERSIST, err
+	}
+
+	if strings.EqualFold(command, "SCAN") {
+		response, err := scan(db, args)
+		return response, SCAN, err
+	}
+
+	if strings.EqualFold(command, "SSCAN") {
+		response, err := sscan(db, args)
+		return response, SSCAN, err
+	}
+
+	if strings.EqualFold(command, "ZSCAN") {
+		response, err := zscan(db, args)
+		return response, ZSCAN, err
+	}
+
+	if strings.EqualFold(command, "EXISTS") {
+		response, err := exists(db, args)
+		return response, EXISTS, err
+	}
+
+	if strings.EqualFold(command, "RENAME") {
+		response, err := rename(db, args, false)
+		return response, RENAME, err
+	}
+
+	if strings.EqualFold(command, "RENAMENX") {
+		response, err := rename(db, args, true)
+		return response, RENAMENX, err
+	}
+
+	if strings.EqualFold(command, "COPY") {
+		response, err := copyFunc(db, args)
+		return response, COPY, err
+	}
+
+	if strings.EqualFold(command, "MOVE") {
+		response, err := move(db, args)
+		return response, MOVE, err
+	}
+
+	if strings.EqualFold(command, "RANDOMKEY") {
+		response, err := randomkey(db, args)
+		return response, RANDOMKEY, err
+	}
+
+	if strings.EqualFold(command, "DBSIZE") {
+		response, err := dbsize(db, args)
+		return response, DBSIZE, err
+	}
+
+	if strings.EqualFold(command, "TOUCH") {
+		response, err := touch(db, args)
+		return response, TOUCH, err
+	}
+
+	if strings.EqualFold(command, "FLUSHDB") {
+		response, err := flushdb(db, args)
+		return response, FLUSHDB, err
+	}
+
+	if strings.EqualFold(command, "FLUSHALL") {
+		response, err := flushall(args)
+		return response, FLUSHALL, err
+	}
+
+	if strings.EqualFold(command, "SWAPDB") {
+		response, err := swapdb(args)
+		return response, SWAPDB, err
+	}
+
+	if strings.EqualFold(command, "XGROUP") {
+		response, err := xgroup(db, args)
+		return response, XGROUP, err
+	}
+
+	if strings.EqualFold(command, "XREADGROUP") {
+		response, err := xreadgroup(db, args, !conn.inTransaction)
+		return response, XREADGROUP, err
+	}
+
+	if strings.EqualFold(command, "XACK") {
+		response, err := xack(db, args)
+		return response, XACK, err
+	}
+
+	if strings.EqualFold(command, "XPENDING") {
+		response, err := xpending(db, args)
+		return response, XPENDING, err
+	}
+
+	if strings.EqualFold(command, "XCLAIM") {
+		response, err := xclaim(db, args)
+		return response, XCLAIM, err
+	}
+
+	if strings.EqualFold(command, "XAUTOCLAIM") {
+		response, err := xautoclaim(db, args)
+		return response, XAUTOCLAIM, err
+	}
+
+	if strings.EqualFold(command, "XTRIM") {
+		response, err := xtrim(db, args)
+		return response, XTRIM, err
+	}
+
+	if strings.EqualFold(command, "XDEL") {
+		response, err := xdel(db, args)
+		return response, XDEL, err
+	}
+
+	if strings.EqualFold(command, "XLEN") {
+		response, err := xlen(db, args)
+		return response, XLEN, err
+	}
+
+	if strings.EqualFold(command, "XINFO") {
+		response, err := xinfo(db, args)
+		return response, XINFO, err
+	}
+
 	if strings.EqualFold(command, "multi") {
 		response, err := multiFunc(multi)
 		return response, MULTI, err
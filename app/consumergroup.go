@@ -0,0 +1,1063 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consumer groups let several consumers share the work of reading a stream.
+// Every entry delivered to a consumer stays in the pending entries list
+// (PEL) of its group until the consumer acknowledges it with XACK, so that
+// entries of a consumer that died can be claimed by another one: delivery
+// is at-least-once.
+//
+// Each pending entry is referenced both by the PEL of the group and by the
+// PEL of the consumer that owns it.
+
+const (
+	xautoclaimDefaultCount = 100
+	// XAUTOCLAIM looks at up to COUNT times this many pending entries
+	xautoclaimAttemptsFactor = 10
+	// Entries read counter of a group whose position in the stream is not
+	// known
+	streamInvalidEntriesRead = -1
+)
+
+type pendingEntry struct {
+	id            streamID
+	consumer      *consumer
+	deliveredAt   time.Time
+	deliveryCount int
+}
+
+type consumer struct {
+	name string
+	// Last time the consumer tried to read or claim entries
+	seenAt time.Time
+	// Last time the consumer actually read or claimed entries, zero if it
+	// never did
+	activeAt time.Time
+	pending  map[streamID]*pendingEntry
+}
+
+type consumerGroup struct {
+	lastDeliveredID streamID
+	// Number of entries of the stream up to lastDeliveredID, including
+	// deleted and trimmed ones, used to compute the lag of the group
+	entriesRead int
+	pending     map[streamID]*pendingEntry
+	consumers   map[string]*consumer
+}
+
+func newConsumerGroup(lastDeliveredID streamID, entriesRead int) *consumerGroup {
+	return &consumerGroup{
+		lastDeliveredID: lastDeliveredID,
+		entriesRead:     entriesRead,
+		pending:         make(map[streamID]*pendingEntry),
+		consumers:       make(map[string]*consumer),
+	}
+}
+
+// hasTombstonesFrom reports whether an entry with an ID of at least `start`
+// may have been deleted.
+func (s stream) hasTombstonesFrom(start streamID) bool {
+	if len(s.entries) == 0 || s.maxDeletedID == (streamID{}) || s.maxDeletedID.less(s.entries[0].id) {
+		return false
+	}
+
+	return !s.maxDeletedID.less(start)
+}
+
+// estimateEntriesRead returns how many entries were added up to `id`, or
+// streamInvalidEntriesRead if deletions make it impossible to tell, like
+// Redis does.
+func (s stream) estimateEntriesRead(id streamID) int {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+
+	if id == s.lastID || (len(s.entries) == 0 && id.less(s.lastID)) {
+		return s.entriesAdded
+	}
+
+	if s.lastID.less(id) {
+		return streamInvalidEntriesRead
+	}
+
+	firstID := s.entries[0].id
+	if s.maxDeletedID == (streamID{}) || s.maxDeletedID.less(firstID) {
+		// Every entry from the first one on is still there
+		if id.less(firstID) {
+			return s.entriesAdded - len(s.entries)
+		}
+
+		if id == firstID {
+			return s.entriesAdded - len(s.entries) + 1
+		}
+	}
+
+	return streamInvalidEntriesRead
+}
+
+// markDelivered moves the last delivered ID of the group to `id`, an entry
+// of the stream, keeping count of the entries read. As trimming only evicts
+// the oldest entries, the count is exact unless an entry after `id` was
+// deleted.
+func (g *consumerGroup) markDelivered(s stream, id streamID) {
+	if !id.less(s.maxDeletedID) {
+		g.entriesRead = s.entriesAdded - len(s.entriesAfter(id, 0))
+	} else {
+		g.entriesRead = s.estimateEntriesRead(id)
+	}
+
+	g.lastDeliveredID = id
+}
+
+// lag returns the number of entries not delivered to the group yet, ok
+// being false if it cannot be computed because of deleted entries.
+func (g *consumerGroup) lag(s stream) (int, bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+
+	entriesRead := g.entriesRead
+	if entriesRead == streamInvalidEntriesRead || s.hasTombstonesFrom(g.lastDeliveredID) {
+		entriesRead = s.estimateEntriesRead(g.lastDeliveredID)
+	}
+
+	if entriesRead == streamInvalidEntriesRead {
+		return 0, false
+	}
+
+	return s.entriesAdded - entriesRead, true
+}
+
+// getConsumer returns the consumer named `name`, creating it if needed. It
+// reports whether it was created.
+func (g *consumerGroup) getConsumer(name string, now time.Time) (*consumer, bool) {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &consumer{name: name, pending: make(map[streamID]*pendingEntry)}
+		g.consumers[name] = c
+	}
+
+	c.seenAt = now
+
+	return c, !ok
+}
+
+// claim makes `c` the owner of a pending entry, creating it if needed.
+func (g *consumerGroup) claim(id streamID, c *consumer, deliveredAt time.Time) *pendingEntry {
+	pe, ok := g.pending[id]
+	if !ok {
+		pe = &pendingEntry{id: id}
+		g.pending[id] = pe
+	}
+
+	if pe.consumer != nil {
+		delete(pe.consumer.pending, id)
+	}
+
+	pe.consumer = c
+	pe.deliveredAt = deliveredAt
+	c.pending[id] = pe
+
+	return pe
+}
+
+func (g *consumerGroup) acknowledge(id streamID) bool {
+	pe, ok := g.pending[id]
+	if !ok {
+		return false
+	}
+
+	delete(g.pending, id)
+	delete(pe.consumer.pending, id)
+
+	return true
+}
+
+func sortedPendingEntries(pending map[streamID]*pendingEntry) []*pendingEntry {
+	entries := make([]*pendingEntry, 0, len(pending))
+	for _, pe := range pending {
+		entries = append(entries, pe)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id.less(entries[j].id)
+	})
+
+	return entries
+}
+
+func sortedGroupNames(s stream) []string {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func sortedConsumers(g *consumerGroup) []*consumer {
+	consumers := make([]*consumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, c)
+	}
+
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].name < consumers[j].name
+	})
+
+	return consumers
+}
+
+// cloneConsumerGroups deep copies the consumer groups of a stream, for COPY.
+func cloneConsumerGroups(groups map[string]*consumerGroup) map[string]*consumerGroup {
+	cloned := make(map[string]*consumerGroup, len(groups))
+
+	for name, g := range groups {
+		clone := newConsumerGroup(g.lastDeliveredID, g.entriesRead)
+		for _, c := range g.consumers {
+			copied, _ := clone.getConsumer(c.name, c.seenAt)
+			copied.activeAt = c.activeAt
+		}
+
+		for id, pe := range g.pending {
+			clone.claim(id, clone.consumers[pe.consumer.name], pe.deliveredAt).deliveryCount = pe.deliveryCount
+		}
+
+		cloned[name] = clone
+	}
+
+	return cloned
+}
+
+// getConsumerGroup returns the stream at key and its group `name`, or a
+// NOGROUP error if either does not exist.
+func getConsumerGroup(db database, key string, name string) (stream, *consumerGroup, error) {
+	s, ok, err := getStream(db, key)
+	if err != nil {
+		return s, nil, err
+	}
+
+	g, groupOk := s.groups[name]
+	if !ok || !groupOk {
+		return s, nil, errNoGroup(key, name)
+	}
+
+	return s, g, nil
+}
+
+// propagateClaim replicates the delivery of a pending entry as an XCLAIM
+// that sets its owner, delivery time and count as they are on the master.
+func propagateClaim(db database, key string, groupName string, g *consumerGroup, pe *pendingEntry) {
+	propagate(db, "XCLAIM", key, groupName, pe.consumer.name, "0", pe.id.String(),
+		"TIME", strconv.FormatInt(pe.deliveredAt.UnixMilli(), 10),
+		"RETRYCOUNT", strconv.Itoa(pe.deliveryCount),
+		"FORCE", "JUSTID", "LASTID", g.lastDeliveredID.String())
+}
+
+func xgroup(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	subcommand := strings.ToUpper(args[0])
+
+	switch subcommand {
+	case "CREATE":
+		return xgroupCreate(db, args[1:])
+	case "SETID":
+		return xgroupSetID(db, args[1:])
+	case "DESTROY":
+		return xgroupDestroy(db, args[1:])
+	case "CREATECONSUMER":
+		return xgroupCreateConsumer(db, args[1:])
+	case "DELCONSUMER":
+		return xgroupDelConsumer(db, args[1:])
+	}
+
+	return nil, errUnknownSubcommand(subcommand, "XGROUP")
+}
+
+// parseGroupLastID parses the ID a group starts reading after, `$` meaning
+// the last entry of the stream.
+func parseGroupLastID(s stream, id string) (streamID, error) {
+	if id == "$" {
+		return s.lastID, nil
+	}
+
+	return parseStreamID(id, 0)
+}
+
+// parseEntriesRead parses the ENTRIESREAD option of XGROUP CREATE and
+// SETID, -1 meaning the number of entries read is unknown.
+func parseEntriesRead(s string) (int, error) {
+	entriesRead, err := parseInteger(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if entriesRead < streamInvalidEntriesRead {
+		return 0, ErrRespInvalidEntriesRead
+	}
+
+	return entriesRead, nil
+}
+
+// xgroupCreate implements XGROUP CREATE key group id|$ [MKSTREAM]
+// [ENTRIESREAD entries-read].
+func xgroupCreate(db database, args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	groupName := args[1]
+	mkstream := false
+	entriesRead := streamInvalidEntriesRead
+
+	options := args[3:]
+	for i := 0; i < len(options); i++ {
+		if strings.EqualFold(options[i], "MKSTREAM") {
+			mkstream = true
+		} else if strings.EqualFold(options[i], "ENTRIESREAD") && i+1 < len(options) {
+			var err error
+			entriesRead, err = parseEntriesRead(options[i+1])
+			if err != nil {
+				return nil, err
+			}
+			i++
+		} else {
+			return nil, ErrRespSyntax
+		}
+	}
+
+	s, ok, err := getStream(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		if !mkstream {
+			return nil, ErrRespXGroupKeyMissing
+		}
+
+		s = newStream()
+		db.streamStore[key] = s
+		db.keys.insert(key)
+	}
+
+	if _, ok := s.groups[groupName]; ok {
+		return nil, ErrRespBusyGroup
+	}
+
+	lastID, err := parseGroupLastID(s, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	s.groups[groupName] = newConsumerGroup(lastID, entriesRead)
+
+	return []byte("+OK\r\n"), nil
+}
+
+func xgroupDestroy(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	s, _, err := getConsumerGroup(db, key, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.groups, args[1])
+	// Clients blocked on the group are told it is gone
+	signalKeyAsReady(db, key)
+
+	return encodeRespInteger(1), nil
+}
+
+func xgroupCreateConsumer(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	_, g, err := getConsumerGroup(db, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, created := g.getConsumer(args[2], time.Now()); !created {
+		return encodeRespInteger(0), nil
+	}
+
+	return encodeRespInteger(1), nil
+}
+
+// xgroupDelConsumer deletes a consumer, and its pending entries from the
+// PEL of the group. It replies how many entries were pending.
+func xgroupDelConsumer(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	_, g, err := getConsumerGroup(db, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := g.consumers[args[2]]
+	if !ok {
+		return encodeRespInteger(0), nil
+	}
+
+	for id := range c.pending {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, c.name)
+
+	return encodeRespInteger(len(c.pending)), nil
+}
+
+// xgroupSetID implements XGROUP SETID key group id|$ [ENTRIESREAD
+// entries-read].
+func xgroupSetID(db database, args []string) ([]byte, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	entriesRead := streamInvalidEntriesRead
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "ENTRIESREAD") {
+			return nil, ErrRespSyntax
+		}
+
+		var err error
+		entriesRead, err = parseEntriesRead(args[4])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s, g, err := getConsumerGroup(db, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := parseGroupLastID(s, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	g.lastDeliveredID = lastID
+	g.entriesRead = entriesRead
+
+	return []byte("+OK\r\n"), nil
+}
+
+// xreadgroup implements XREADGROUP GROUP group consumer [COUNT count]
+// [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...].
+// The `>` ID delivers entries never delivered to the group, and may block
+// until some are added. Any other ID reads back the pending entries of the
+// consumer, entries deleted since being delivered being replied as nil.
+func xreadgroup(db database, args []string, mayBlock bool) ([]byte, error) {
+	var groupName, consumerName string
+	var streamArgs []string
+	var timeout time.Duration
+	count := 0
+	blocking := false
+	noAck := false
+
+	for i := 0; i < len(args) && streamArgs == nil; i++ {
+		option := strings.ToUpper(args[i])
+
+		switch {
+		case option == "GROUP" && i+2 < len(args):
+			groupName, consumerName = args[i+1], args[i+2]
+			i += 2
+		case option == "COUNT" && i+1 < len(args):
+			n, err := parseInteger(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			count = max(n, 0)
+			i++
+		case option == "BLOCK" && i+1 < len(args):
+			ms, err := parseInteger(args[i+1])
+			if err != nil {
+				return nil, ErrRespTimeoutNotInteger
+			}
+
+			if ms < 0 {
+				return nil, ErrRespTimeoutNegative
+			}
+
+			blocking = true
+			timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case option == "NOACK":
+			noAck = true
+		case option == "STREAMS":
+			streamArgs = args[i+1:]
+		default:
+			return nil, ErrRespSyntax
+		}
+	}
+
+	if groupName == "" {
+		return nil, ErrRespXReadGroupMissingGroup
+	}
+
+	if len(streamArgs) == 0 || len(streamArgs)%2 != 0 {
+		return nil, errUnbalancedStreams("xreadgroup")
+	}
+
+	keys := streamArgs[:len(streamArgs)/2]
+	ids := streamArgs[len(streamArgs)/2:]
+
+	// Check everything before delivering anything
+	historyIDs := make([]streamID, len(ids))
+	onlyNew := true
+	for i, key := range keys {
+		if _, _, err := getConsumerGroup(db, key, groupName); err != nil {
+			return nil, err
+		}
+
+		if ids[i] == ">" {
+			continue
+		}
+
+		id, err := parseStreamID(ids[i], 0)
+		if err != nil {
+			return nil, err
+		}
+
+		historyIDs[i] = id
+		onlyNew = false
+	}
+
+	now := time.Now()
+	replies := make([][]byte, 0, len(keys))
+
+	for i, key := range keys {
+		s, g, _ := getConsumerGroup(db, key, groupName)
+
+		c, created := g.getConsumer(consumerName, now)
+		if created {
+			propagate(db, "XGROUP", "CREATECONSUMER", key, groupName, consumerName)
+		}
+
+		if ids[i] == ">" {
+			entries := deliverNewEntries(db, key, groupName, s, g, c, count, noAck, now)
+			if len(entries) > 0 {
+				replies = append(replies, encodeStreamReply(key, encodeStreamEntries(entries)))
+			}
+
+			continue
+		}
+
+		replies = append(replies, encodeStreamReply(key, readPendingEntries(db, key, groupName, s, g, c, historyIDs[i], count, now)))
+	}
+
+	if len(replies) > 0 || !onlyNew || !blocking || !mayBlock {
+		if len(replies) == 0 {
+			return []byte("*-1\r\n"), nil
+		}
+
+		return encodeRespArray(replies), nil
+	}
+
+	serve := func(db database, key string) ([]byte, bool) {
+		s, g, err := getConsumerGroup(db, key, groupName)
+		if err != nil {
+			return []byte(err.Error()), true
+		}
+
+		now := time.Now()
+		c, created := g.getConsumer(consumerName, now)
+		if created {
+			propagate(db, "XGROUP", "CREATECONSUMER", key, groupName, consumerName)
+		}
+
+		entries := deliverNewEntries(db, key, groupName, s, g, c, count, noAck, now)
+		if len(entries) == 0 {
+			return nil, false
+		}
+
+		return encodeRespArray([][]byte{encodeStreamReply(key, encodeStreamEntries(entries))}), true
+	}
+
+	reply := blockForKeys(db, keys, timeout, serve)
+	if reply == nil {
+		return []byte("*-1\r\n"), nil
+	}
+
+	return reply, nil
+}
+
+// deliverNewEntries delivers the entries the group has not delivered yet to
+// consumer `c`, adding them to its PEL unless `noAck` is set. The new
+// position of the group is replicated along with its entries read counter.
+func deliverNewEntries(db database, key string, groupName string, s stream, g *consumerGroup, c *consumer, count int, noAck bool, now time.Time) []streamEntry {
+	entries := s.entriesAfter(g.lastDeliveredID, count)
+	if len(entries) == 0 {
+		return entries
+	}
+
+	c.activeAt = now
+	g.markDelivered(s, entries[len(entries)-1].id)
+
+	if !noAck {
+		for _, entry := range entries {
+			pe := g.claim(entry.id, c, now)
+			pe.deliveryCount = 1
+			propagateClaim(db, key, groupName, g, pe)
+		}
+	}
+
+	propagate(db, "XGROUP", "SETID", key, groupName, g.lastDeliveredID.String(), "ENTRIESREAD", strconv.Itoa(g.entriesRead))
+
+	return entries
+}
+
+// readPendingEntries delivers again the pending entries of consumer `c`
+// with an ID greater than `after`.
+func readPendingEntries(db database, key string, groupName string, s stream, g *consumerGroup, c *consumer, after streamID, count int, now time.Time) [][]byte {
+	encoded := make([][]byte, 0)
+
+	for _, pe := range sortedPendingEntries(c.pending) {
+		if !after.less(pe.id) {
+			continue
+		}
+
+		if count > 0 && len(encoded) == count {
+			break
+		}
+
+		pe.deliveredAt = now
+		pe.deliveryCount++
+		c.activeAt = now
+		propagateClaim(db, key, groupName, g, pe)
+
+		entry, ok := s.entry(pe.id)
+		if !ok {
+			encoded = append(encoded, encodeRespArray([][]byte{encodeRespBulkString(pe.id.String()), []byte("*-1\r\n")}))
+			continue
+		}
+
+		encoded = append(encoded, entry.encode())
+	}
+
+	return encoded
+}
+
+func xack(db database, args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	ids := make([]streamID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	_, g, err := getConsumerGroup(db, args[0], args[1])
+	if err == ErrRespWrongType {
+		return nil, err
+	}
+
+	if err != nil {
+		return encodeRespInteger(0), nil
+	}
+
+	acknowledged := 0
+	for _, id := range ids {
+		if g.acknowledge(id) {
+			acknowledged++
+		}
+	}
+
+	return encodeRespInteger(acknowledged), nil
+}
+
+// xpending implements XPENDING key group [[IDLE min-idle-time] start end
+// count [consumer]]. Without a range it replies a summary of the PEL.
+func xpending(db database, args []string) ([]byte, error) {
+	if len(args) < 2 || (len(args) > 2 && len(args) < 5) {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	_, g, err := getConsumerGroup(db, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 2 {
+		return xpendingSummary(g), nil
+	}
+
+	options := args[2:]
+	minIdle := time.Duration(0)
+
+	if strings.EqualFold(options[0], "IDLE") {
+		ms, err := parseInteger(options[1])
+		if err != nil {
+			return nil, err
+		}
+
+		minIdle = time.Duration(ms) * time.Millisecond
+		options = options[2:]
+	}
+
+	if len(options) != 3 && len(options) != 4 {
+		return nil, ErrRespSyntax
+	}
+
+	start, err := parseStreamRangeBound(options[0], true)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseStreamRangeBound(options[1], false)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := parseInteger(options[2])
+	if err != nil {
+		return nil, err
+	}
+
+	pending := g.pending
+	if len(options) == 4 {
+		c, ok := g.consumers[options[3]]
+		if !ok {
+			return []byte("*0\r\n"), nil
+		}
+
+		pending = c.pending
+	}
+
+	now := time.Now()
+	replies := make([][]byte, 0)
+
+	for _, pe := range sortedPendingEntries(pending) {
+		if len(replies) >= count {
+			break
+		}
+
+		if pe.id.less(start) || end.less(pe.id) || now.Sub(pe.deliveredAt) < minIdle {
+			continue
+		}
+
+		replies = append(replies, encodeRespArray([][]byte{
+			encodeRespBulkString(pe.id.String()),
+			encodeRespBulkString(pe.consumer.name),
+			encodeRespInteger(int(now.Sub(pe.deliveredAt).Milliseconds())),
+			encodeRespInteger(pe.deliveryCount),
+		}))
+	}
+
+	return encodeRespArray(replies), nil
+}
+
+// xpendingSummary replies the number of pending entries, the smallest and
+// greatest pending IDs, and how many entries each consumer has pending.
+func xpendingSummary(g *consumerGroup) []byte {
+	if len(g.pending) == 0 {
+		return []byte("*4\r\n:0\r\n$-1\r\n$-1\r\n*-1\r\n")
+	}
+
+	entries := sortedPendingEntries(g.pending)
+
+	names := make([]string, 0, len(g.consumers))
+	for name, c := range g.consumers {
+		if len(c.pending) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	consumers := make([][]byte, 0, len(names))
+	for _, name := range names {
+		consumers = append(consumers, encodeRespStringArray([]string{name, strconv.Itoa(len(g.consumers[name].pending))}))
+	}
+
+	return encodeRespArray([][]byte{
+		encodeRespInteger(len(entries)),
+		encodeRespBulkString(entries[0].id.String()),
+		encodeRespBulkString(entries[len(entries)-1].id.String()),
+		encodeRespArray(consumers),
+	})
+}
+
+type claimOptions struct {
+	// When set, the time the entries are considered delivered at
+	deliveredAt *time.Time
+	retryCount  int
+	force       bool
+	justID      bool
+	lastID      *streamID
+}
+
+func parseClaimOptions(args []string, now time.Time) (claimOptions, error) {
+	options := claimOptions{retryCount: -1}
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+
+		switch {
+		case (option == "IDLE" || option == "TIME" || option == "RETRYCOUNT") && i+1 < len(args):
+			n, err := parseInteger(args[i+1])
+			if err != nil {
+				return options, err
+			}
+			i++
+
+			switch option {
+			case "IDLE":
+				deliveredAt := now.Add(-time.Duration(n) * time.Millisecond)
+				options.deliveredAt = &deliveredAt
+			case "TIME":
+				deliveredAt := time.UnixMilli(int64(n))
+				options.deliveredAt = &deliveredAt
+			default:
+				options.retryCount = n
+			}
+		case option == "LASTID" && i+1 < len(args):
+			id, err := parseStreamID(args[i+1], 0)
+			if err != nil {
+				return options, err
+			}
+
+			options.lastID = &id
+			i++
+		case option == "FORCE":
+			options.force = true
+		case option == "JUSTID":
+			options.justID = true
+		default:
+			return options, errUnrecognizedXClaimOption(args[i])
+		}
+	}
+
+	return options, nil
+}
+
+// xclaim implements XCLAIM key group consumer min-idle-time id [id ...]
+// [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE]
+// [JUSTID] [LASTID lastid].
+// Pending entries idle for at least min-idle-time change owner. Entries
+// deleted from the stream are dropped from the PEL instead.
+func xclaim(db database, args []string) ([]byte, error) {
+	if len(args) < 5 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	groupName := args[1]
+	now := time.Now()
+
+	minIdleMs, err := parseInteger(args[3])
+	if err != nil {
+		return nil, ErrRespInvalidMinIdleTime
+	}
+	minIdle := time.Duration(max(minIdleMs, 0)) * time.Millisecond
+
+	ids := make([]streamID, 0)
+	optionsStart := len(args)
+	for i, arg := range args[4:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			// At least one ID comes before the options
+			if i == 0 {
+				return nil, err
+			}
+
+			optionsStart = i + 4
+			break
+		}
+
+		ids = append(ids, id)
+	}
+
+	options, err := parseClaimOptions(args[optionsStart:], now)
+	if err != nil {
+		return nil, err
+	}
+
+	s, g, err := getConsumerGroup(db, key, groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.lastID != nil && g.lastDeliveredID.less(*options.lastID) {
+		g.lastDeliveredID = *options.lastID
+	}
+
+	deliveredAt := now
+	if options.deliveredAt != nil {
+		deliveredAt = *options.deliveredAt
+	}
+
+	c, _ := g.getConsumer(args[2], now)
+	replies := make([][]byte, 0)
+
+	for _, id := range ids {
+		entry, exists := s.entry(id)
+
+		pe, ok := g.pending[id]
+		if !ok {
+			if !options.force || !exists {
+				continue
+			}
+		} else {
+			if now.Sub(pe.deliveredAt) < minIdle {
+				continue
+			}
+
+			if !exists {
+				g.acknowledge(id)
+				propagate(db, "XACK", key, groupName, id.String())
+				continue
+			}
+		}
+
+		pe = g.claim(id, c, deliveredAt)
+		c.activeAt = now
+		if options.retryCount >= 0 {
+			pe.deliveryCount = options.retryCount
+		} else if !options.justID || !ok {
+			pe.deliveryCount++
+		}
+
+		propagateClaim(db, key, groupName, g, pe)
+
+		if options.justID {
+			replies = append(replies, encodeRespBulkString(id.String()))
+		} else {
+			replies = append(replies, entry.encode())
+		}
+	}
+
+	return encodeRespArray(replies), nil
+}
+
+// xautoclaim implements XAUTOCLAIM key group consumer min-idle-time start
+// [COUNT count] [JUSTID].
+// It claims up to COUNT entries idle for at least min-idle-time, scanning
+// the PEL from `start`, and replies the ID to continue the scan from, 0-0
+// once done, the claimed entries and the IDs of the entries that were
+// deleted from the stream, and dropped from the PEL.
+func xautoclaim(db database, args []string) ([]byte, error) {
+	if len(args) < 5 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	groupName := args[1]
+	count := xautoclaimDefaultCount
+	justID := false
+
+	minIdleMs, err := parseInteger(args[3])
+	if err != nil {
+		return nil, ErrRespInvalidMinIdleTime
+	}
+	minIdle := time.Duration(max(minIdleMs, 0)) * time.Millisecond
+
+	start, err := parseStreamRangeBound(args[4], true)
+	if err != nil {
+		return nil, err
+	}
+
+	options := args[5:]
+	for i := 0; i < len(options); i++ {
+		if strings.EqualFold(options[i], "COUNT") && i+1 < len(options) {
+			count, err = parseInteger(options[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			if count < 1 || count > math.MaxInt/xautoclaimAttemptsFactor {
+				return nil, ErrRespXAutoClaimCountOutOfRange
+			}
+			i++
+		} else if strings.EqualFold(options[i], "JUSTID") {
+			justID = true
+		} else {
+			return nil, ErrRespSyntax
+		}
+	}
+
+	s, g, err := getConsumerGroup(db, key, groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	c, _ := g.getConsumer(args[2], now)
+	attempts := count * xautoclaimAttemptsFactor
+
+	claimed := make([][]byte, 0)
+	deleted := make([]string, 0)
+	next := streamID{}
+
+	for _, pe := range sortedPendingEntries(g.pending) {
+		if pe.id.less(start) {
+			continue
+		}
+
+		if attempts == 0 || len(claimed) == count {
+			next = pe.id
+			break
+		}
+		attempts--
+
+		if now.Sub(pe.deliveredAt) < minIdle {
+			continue
+		}
+
+		entry, exists := s.entry(pe.id)
+		if !exists {
+			g.acknowledge(pe.id)
+			propagate(db, "XACK", key, groupName, pe.id.String())
+			deleted = append(deleted, pe.id.String())
+			continue
+		}
+
+		g.claim(pe.id, c, now)
+		c.activeAt = now
+		if !justID {
+			pe.deliveryCount++
+		}
+
+		propagateClaim(db, key, groupName, g, pe)
+
+		if justID {
+			claimed = append(claimed, encodeRespBulkString(pe.id.String()))
+		} else {
+			claimed = append(claimed, entry.encode())
+		}
+	}
+
+	return encodeRespArray([][]byte{
+		encodeRespBulkString(next.String()),
+		encodeRespArray(claimed),
+		encodeRespStringArray(deleted),
+	}), nil
+}
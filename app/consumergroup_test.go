@@ -0,0 +1,167 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsumerGroupPendingEntries(t *testing.T) {
+	db := setupTestStore()
+
+	if _, err := xgroupCreate(db, []string{"s", "g", "$", "MKSTREAM"}); err != nil {
+		t.Fatalf("xgroup create error = %v", err)
+	}
+
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		if _, err := xadd(db, []string{"s", id, "field", "value"}); err != nil {
+			t.Fatalf("xadd %s error = %v", id, err)
+		}
+	}
+
+	xreadgroup(db, []string{"GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">"}, false)
+	xreadgroup(db, []string{"GROUP", "g", "bob", "STREAMS", "s", ">"}, false)
+
+	_, g, _ := getConsumerGroup(db, "s", "g")
+	if len(g.pending) != 3 || len(g.consumers["alice"].pending) != 2 || len(g.consumers["bob"].pending) != 1 {
+		t.Fatalf("PEL sizes = %d, %d, %d, want 3, 2, 1", len(g.pending), len(g.consumers["alice"].pending), len(g.consumers["bob"].pending))
+	}
+
+	if g.lastDeliveredID != (streamID{ms: 3, seq: 1}) {
+		t.Errorf("last delivered ID = %v, want 3-1", g.lastDeliveredID)
+	}
+
+	got, _ := xack(db, []string{"s", "g", "1-1", "1-1", "9-9"})
+	if string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("xack = %q, want 1", got)
+	}
+
+	// Entries are only claimed once idle for long enough
+	got, _ = xclaim(db, []string{"s", "g", "bob", "3600000", "2-1"})
+	if string(got) != "*0\r\n" {
+		t.Errorf("xclaim of a recently delivered entry = %q, want empty", got)
+	}
+
+	g.pending[streamID{ms: 2, seq: 1}].deliveredAt = time.Now().Add(-2 * time.Hour)
+
+	xclaim(db, []string{"s", "g", "bob", "3600000", "2-1"})
+	pe := g.pending[streamID{ms: 2, seq: 1}]
+	if pe.consumer.name != "bob" || pe.deliveryCount != 2 || len(g.consumers["alice"].pending) != 0 {
+		t.Errorf("claimed entry owner = %s, delivery count = %d, want bob, 2", pe.consumer.name, pe.deliveryCount)
+	}
+
+	// Entries deleted from the stream are dropped from the PEL
+	s := db.streamStore["s"]
+	s.entries = s.entries[:1]
+	db.streamStore["s"] = s
+
+	got, _ = xautoclaim(db, []string{"s", "g", "carol", "0", "-"})
+	want := encodeRespArray([][]byte{
+		encodeRespBulkString("0-0"),
+		encodeRespArray([][]byte{}),
+		encodeRespStringArray([]string{"2-1", "3-1"}),
+	})
+	if string(got) != string(want) {
+		t.Errorf("xautoclaim = %q, want %q", got, want)
+	}
+
+	if len(g.pending) != 0 || len(g.consumers["bob"].pending) != 0 {
+		t.Errorf("deleted entries left in the PEL")
+	}
+}
+
+func TestBlockingXReadGroupIsServedByXAdd(t *testing.T) {
+	db := setupTestStore()
+	xgroupCreate(db, []string{"s", "g", "$", "MKSTREAM"})
+
+	replyC := make(chan []byte)
+	go func() {
+		reply, _ := runLocked(func() ([]byte, error) {
+			return xreadgroup(db, []string{"GROUP", "g", "c", "BLOCK", "0", "STREAMS", "s", ">"}, true)
+		})
+		replyC <- reply
+	}()
+
+	waitForBlockedClients(t, "s", 1)
+
+	runLocked(func() ([]byte, error) {
+		return xadd(db, []string{"s", "1-1", "field", "value"})
+	})
+
+	select {
+	case reply := <-replyC:
+		want := encodeRespArray([][]byte{encodeStreamReply("s", [][]byte{streamEntry{id: streamID{ms: 1, seq: 1}, fields: []string{"field", "value"}}.encode()})})
+		if string(reply) != string(want) {
+			t.Errorf("xreadgroup = %q, want %q", reply, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("xreadgroup was not served by xadd")
+	}
+}
+
+func TestConsumerGroupLag(t *testing.T) {
+	db := setupTestStore()
+	for _, id := range []string{"1-1", "2-1", "3-1", "4-1"} {
+		xadd(db, []string{"s", id, "field", "value"})
+	}
+
+	xgroupCreate(db, []string{"s", "g", "0"})
+	xgroupCreate(db, []string{"s", "late", "$"})
+
+	lag := func(name string) (int, bool) {
+		s := db.streamStore["s"]
+		return s.groups[name].lag(s)
+	}
+
+	if got, ok := lag("g"); !ok || got != 4 {
+		t.Errorf("lag of a group reading from the start = %d, %v, want 4", got, ok)
+	}
+
+	if got, ok := lag("late"); !ok || got != 0 {
+		t.Errorf("lag of a group created at the end = %d, %v, want 0", got, ok)
+	}
+
+	xreadgroup(db, []string{"GROUP", "g", "c", "COUNT", "1", "STREAMS", "s", ">"}, false)
+	if g := db.streamStore["s"].groups["g"]; g.entriesRead != 1 {
+		t.Errorf("entries read = %d, want 1", g.entriesRead)
+	}
+
+	if got, ok := lag("g"); !ok || got != 3 {
+		t.Errorf("lag after a read = %d, %v, want 3", got, ok)
+	}
+
+	// An entry deleted after the group position makes the lag unknown
+	xdel(db, []string{"s", "3-1"})
+	if _, ok := lag("g"); ok {
+		t.Errorf("lag with a deleted entry ahead is known")
+	}
+
+	// Deletions before the first entry do not matter
+	xdel(db, []string{"s", "1-1"})
+	xtrim(db, []string{"s", "MINID", "4"})
+	xreadgroup(db, []string{"GROUP", "g", "c", "STREAMS", "s", ">"}, false)
+	if got, ok := lag("g"); !ok || got != 0 {
+		t.Errorf("lag once everything is read = %d, %v, want 0", got, ok)
+	}
+}
+
+func TestXClaimArguments(t *testing.T) {
+	db := setupTestStore()
+	xgroupCreate(db, []string{"s", "g", "$", "MKSTREAM"})
+
+	tests := []struct {
+		args []string
+		want error
+	}{
+		{[]string{"s", "g", "c", "0", "nope"}, ErrRespInvalidStreamID},
+		{[]string{"s", "g", "c", "0", "JUSTID"}, ErrRespInvalidStreamID},
+		{[]string{"s", "g", "c", "0", "1-1", "nope"}, errUnrecognizedXClaimOption("nope")},
+		{[]string{"s", "g", "c", "0", "1-1", "2-1", "JUSTID"}, nil},
+	}
+
+	for _, tt := range tests {
+		_, err := xclaim(db, tt.args)
+		if (err == nil) != (tt.want == nil) || (err != nil && err.Error() != tt.want.Error()) {
+			t.Errorf("xclaim(%v) error = %v, want %v", tt.args, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expired keys and fields are deleted lazily when accessed, and actively by
+// a background cycle so that memory is reclaimed even when nobody reads them.
+// Deletions are replicated, so that replicas never expire keys on their own
+// clock.
+
+const (
+	activeExpireCycleInterval = 100 * time.Millisecond
+	// Share of the interval the cycle is allowed to keep the store locked
+	activeExpireCycleBudget = activeExpireCycleInterval / 4
+	// Number of keys with a TTL checked at once
+	activeExpireCycleSampleSize = 20
+	// The cycle keeps sampling a database while more than this share of the
+	// sampled keys turn out to be expired
+	activeExpireCycleAcceptableStale = 0.25
+)
+
+// expireStats are reported in the stats section of INFO.
+type expireStats struct {
+	expiredKeys int
+	// Expired hash fields
+	expiredSubkeys int
+	// Running estimate of the share of keys with a TTL that are expired but
+	// not reclaimed yet
+	stalePercentage     float64
+	timeCapReachedCount int
+	cycleTime           time.Duration
+}
+
+// expiryTime converts an expiry expressed in `unit`, either relative to now
+// or as a unix timestamp, to a point in time. It fails if the expiry does
+// not fit in a millisecond timestamp.
+func expiryTime(expiry int, unit time.Duration, absolute bool, now time.Time) (time.Time, error) {
+	unitMs := int(unit / time.Millisecond)
+
+	if expiry > math.MaxInt64/unitMs || expiry < math.MinInt64/unitMs {
+		return time.Time{}, ErrOutOfBounds
+	}
+
+	ms := expiry * unitMs
+
+	if !absolute {
+		nowMs := int(now.UnixMilli())
+		if ms > math.MaxInt64-nowMs {
+			return time.Time{}, ErrOutOfBounds
+		}
+
+		ms += nowMs
+	}
+
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// parseExpiryOption returns the unit of the EX, PX, EXAT and PXAT options
+// shared by SET and GETEX, and whether they take a unix timestamp.
+func parseExpiryOption(option string) (time.Duration, bool, bool) {
+	switch strings.ToUpper(option) {
+	case "EX":
+		return time.Second, false, true
+	case "PX":
+		return time.Millisecond, false, true
+	case "EXAT":
+		return time.Second, true, true
+	case "PXAT":
+		return time.Millisecond, true, true
+	}
+
+	return 0, false, false
+}
+
+// formatExpiry returns what the TTL family of commands reply for an expiry:
+// either the time left or the unix timestamp, in `unit`.
+func formatExpiry(expiresAt time.Time, unit time.Duration, absolute bool, now time.Time) int {
+	unitMs := int64(unit / time.Millisecond)
+
+	if absolute {
+		return int(expiresAt.UnixMilli() / unitMs)
+	}
+
+	ttl := max(expiresAt.UnixMilli()-now.UnixMilli(), 0)
+
+	// Round to the closest unit
+	return int((ttl + unitMs/2) / unitMs)
+}
+
+// expireIfNeeded deletes key if its TTL has passed. It reports whether the
+// key was deleted.
+func (db database) expireIfNeeded(key string) bool {
+	if !db.isExpired(key, time.Now()) {
+		return false
+	}
+
+	db.expireKey(key)
+
+	return true
+}
+
+// isExpired reports whether key has a TTL that passed.
+func (db database) isExpired(key string, now time.Time) bool {
+	expiresAt, ok := db.expires[key]
+	return ok && !expiresAt.After(now)
+}
+
+// expireKey deletes an expired key, replicating the deletion as a DEL.
+func (db database) expireKey(key string) {
+	db.deleteKey(key)
+	propagate(db, "DEL", key)
+	status.expireStats.expiredKeys++
+}
+
+// setExpiry sets the TTL of an existing key, or deletes it if `expiresAt` is
+// already past. It is replicated as a PEXPIREAT or a DEL.
+func setExpiry(db database, key string, expiresAt time.Time, now time.Time) {
+	if !expiresAt.After(now) {
+		db.deleteKey(key)
+		propagate(db, "DEL", key)
+		return
+	}
+
+	db.expires[key] = expiresAt
+	propagate(db, "PEXPIREAT", key, strconv.FormatInt(expiresAt.UnixMilli(), 10))
+}
+
+// expiryCondition holds the NX, XX, GT and LT options of the commands that
+// set TTLs on keys or hash fields.
+type expiryCondition struct {
+	nx bool
+	xx bool
+	gt bool
+	lt bool
+}
+
+func (c *expiryCondition) parse(option string) bool {
+	switch strings.ToUpper(option) {
+	case "NX":
+		c.nx = true
+	case "XX":
+		c.xx = true
+	case "GT":
+		c.gt = true
+	case "LT":
+		c.lt = true
+	default:
+		return false
+	}
+
+	return true
+}
+
+// allows reports whether the TTL can be set to `expiresAt` given the current
+// one, having no TTL counting as an infinite TTL.
+func (c expiryCondition) allows(expiresAt time.Time, current time.Time, hasTTL bool) bool {
+	if (c.nx && hasTTL) || (c.xx && !hasTTL) {
+		return false
+	}
+
+	if c.gt && (!hasTTL || !expiresAt.After(current)) {
+		return false
+	}
+
+	if c.lt && hasTTL && !expiresAt.Before(current) {
+		return false
+	}
+
+	return true
+}
+
+// expire implements EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT, which only
+// differ by the unit of the expiry and whether it is relative to now.
+// It replies 1 if the TTL was set, or the key deleted because the expiry is
+// in the past, and 0 if the key does not exist or the NX | XX | GT | LT
+// condition is not met.
+func expire(db database, args []string, commandName string, unit time.Duration, absolute bool) ([]byte, error) {
+	var condition expiryCondition
+
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	now := time.Now()
+
+	expiry, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, option := range args[2:] {
+		if !condition.parse(option) {
+			return nil, errUnsupportedOption(option)
+		}
+	}
+
+	if condition.nx && (condition.xx || condition.gt || condition.lt) {
+		return nil, ErrRespNXAndXXGTLT
+	}
+
+	if condition.gt && condition.lt {
+		return nil, ErrRespGTAndLT
+	}
+
+	expiresAt, err := expiryTime(expiry, unit, absolute, now)
+	if err != nil {
+		return nil, errInvalidExpireTime(commandName)
+	}
+
+	if db.lookupKey(key) == "none" {
+		return encodeRespInteger(0), nil
+	}
+
+	current, hasTTL := db.expires[key]
+	if !condition.allows(expiresAt, current, hasTTL) {
+		return encodeRespInteger(0), nil
+	}
+
+	setExpiry(db, key, expiresAt, now)
+
+	return encodeRespInteger(1), nil
+}
+
+// ttl implements TTL, PTTL, EXPIRETIME and PEXPIRETIME. It replies -2 if the
+// key does not exist, -1 if it has no TTL, and its TTL or expiry timestamp
+// otherwise.
+func ttl(db database, args []string, unit time.Duration, absolute bool) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	if db.lookupKey(key) == "none" {
+		return encodeRespInteger(-2), nil
+	}
+
+	expiresAt, ok := db.expires[key]
+	if !ok {
+		return encodeRespInteger(-1), nil
+	}
+
+	return encodeRespInteger(formatExpiry(expiresAt, unit, absolute, time.Now())), nil
+}
+
+func persist(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	if db.lookupKey(key) == "none" {
+		return encodeRespInteger(0), nil
+	}
+
+	if _, ok := db.expires[key]; !ok {
+		return encodeRespInteger(0), nil
+	}
+
+	delete(db.expires, key)
+
+	return encodeRespInteger(1), nil
+}
+
+func activeExpireLoop() {
+	ticker := time.NewTicker(activeExpireCycleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		status.storeLock.Lock()
+		activeExpireCycle(time.Now().Add(activeExpireCycleBudget))
+		status.storeLock.Unlock()
+	}
+}
+
+// activeExpireCycle reclaims expired keys, then expired fields of the hashes
+// tracked in hashFieldExpires, until it runs out of time. Like Redis, it
+// samples keys with a TTL and moves on to the next database once few enough
+// of the sampled keys are expired.
+// Go randomizes where map iteration starts, so successive samples and cycles
+// do not keep visiting the same keys first.
+func activeExpireCycle(deadline time.Time) {
+	start := time.Now()
+	sampled := 0
+	expired := 0
+
+	defer func() {
+		if sampled > 0 {
+			stale := float64(expired) / float64(sampled)
+			status.expireStats.stalePercentage = stale*0.05 + status.expireStats.stalePercentage*0.95
+		}
+
+		status.expireStats.cycleTime += time.Since(start)
+	}()
+
+	for _, db := range status.databases {
+		for {
+			if time.Now().After(deadline) {
+				status.expireStats.timeCapReachedCount++
+				return
+			}
+
+			s, e := expireSampledKeys(db, activeExpireCycleSampleSize)
+			sampled += s
+			expired += e
+
+			if s == 0 || float64(e) <= float64(s)*activeExpireCycleAcceptableStale {
+				break
+			}
+		}
+	}
+
+	for _, db := range status.databases {
+		for key := range db.hashFieldExpires {
+			now := time.Now()
+			if now.After(deadline) {
+				status.expireStats.timeCapReachedCount++
+				return
+			}
+
+			h, ok := db.hashStore[key]
+			if ok {
+				expireHashFields(db, key, h, now)
+			}
+
+			if !ok || len(h.expires) == 0 {
+				delete(db.hashFieldExpires, key)
+			}
+		}
+	}
+}
+
+// expireSampledKeys checks up to `count` keys with a TTL and deletes the
+// expired ones. It returns how many keys were sampled and expired.
+func expireSampledKeys(db database, count int) (int, int) {
+	sampled := 0
+	expired := 0
+	now := time.Now()
+
+	for key, expiresAt := range db.expires {
+		if sampled == count {
+			break
+		}
+
+		sampled++
+
+		if !expiresAt.After(now) {
+			db.expireKey(key)
+			expired++
+		}
+	}
+
+	return sampled, expired
+}
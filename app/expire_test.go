@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpireConditions(t *testing.T) {
+	db := setupTestStore()
+	db.stringStore["k"] = stringEntry{value: "v"}
+
+	tests := []struct {
+		args []string
+		want int
+		ttl  int
+	}{
+		{[]string{"k", "100", "XX"}, 0, -1},
+		{[]string{"k", "100", "GT"}, 0, -1},
+		{[]string{"k", "100", "LT"}, 1, 100},
+		{[]string{"k", "200", "NX"}, 0, 100},
+		{[]string{"k", "50", "GT"}, 0, 100},
+		{[]string{"k", "200", "XX", "GT"}, 1, 200},
+		{[]string{"missing", "100"}, 0, -2},
+	}
+
+	for _, tt := range tests {
+		got, err := expire(db, tt.args, "expire", time.Second, false)
+		if err != nil {
+			t.Fatalf("expire(%v) error = %v", tt.args, err)
+		}
+
+		if string(got) != string(encodeRespInteger(tt.want)) {
+			t.Errorf("expire(%v) = %q, want %d", tt.args, got, tt.want)
+		}
+
+		ttlReply, _ := ttl(db, tt.args[:1], time.Second, false)
+		if string(ttlReply) != string(encodeRespInteger(tt.ttl)) {
+			t.Errorf("ttl after expire(%v) = %q, want %d", tt.args, ttlReply, tt.ttl)
+		}
+	}
+
+	expire(db, []string{"k", "-1"}, "expire", time.Second, false)
+	if db.lookupKey("k") != "none" {
+		t.Errorf("key with an expiry in the past was not deleted")
+	}
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	db := setupTestStore()
+	status.expireStats = expireStats{}
+
+	past := time.Now().Add(-time.Second)
+	future := time.Now().Add(time.Hour)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("expired%d", i)
+		db.stringStore[key] = stringEntry{value: "v"}
+		db.expires[key] = past
+	}
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("live%d", i)
+		db.stringStore[key] = stringEntry{value: "v"}
+		db.expires[key] = future
+	}
+
+	activeExpireCycle(time.Now().Add(time.Second))
+
+	// Sampling stops once at most a quarter of the sample is expired, which
+	// leaves at most a few expired keys among the live ones
+	if len(db.stringStore) > 10+activeExpireCycleSampleSize/4 {
+		t.Errorf("%d keys left after the cycle", len(db.stringStore))
+	}
+
+	if status.expireStats.expiredKeys != 110-len(db.stringStore) {
+		t.Errorf("expiredKeys = %d, want %d", status.expireStats.expiredKeys, 110-len(db.stringStore))
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, ok := db.stringStore[fmt.Sprintf("live%d", i)]; !ok {
+			t.Errorf("live%d was expired", i)
+		}
+	}
+
+	activeExpireCycle(time.Now().Add(-time.Second))
+
+	if status.expireStats.timeCapReachedCount != 1 {
+		t.Errorf("timeCapReachedCount = %d, want 1", status.expireStats.timeCapReachedCount)
+	}
+}
+
+func TestActiveExpireCycleHashFields(t *testing.T) {
+	db := setupTestStore()
+	status.expireStats = expireStats{}
+
+	for i := 0; i < 100; i++ {
+		hset(db, []string{fmt.Sprintf("plain%d", i), "f", "v"})
+	}
+
+	hset(db, []string{"volatile", "a", "1", "b", "2"})
+	hset(db, []string{"persisted", "a", "1"})
+	hexpire(db, []string{"volatile", "1", "FIELDS", "1", "a"}, "hexpire", time.Second, false)
+	hexpire(db, []string{"persisted", "100", "FIELDS", "1", "a"}, "hexpire", time.Second, false)
+	hpersist(db, []string{"persisted", "FIELDS", "1", "a"})
+
+	// Plain hashes are never visited by the cycle
+	if len(db.hashFieldExpires) != 2 {
+		t.Fatalf("%d hashes tracked, want 2", len(db.hashFieldExpires))
+	}
+
+	db.hashStore["volatile"].expires["a"] = time.Now().Add(-time.Second)
+
+	activeExpireCycle(time.Now().Add(-time.Second))
+
+	if _, ok := db.hashStore["volatile"].fields["a"]; !ok {
+		t.Errorf("field expired past the deadline")
+	}
+
+	activeExpireCycle(time.Now().Add(time.Second))
+
+	if _, ok := db.hashStore["volatile"].fields["a"]; ok {
+		t.Errorf("expired field was not reclaimed")
+	}
+
+	if status.expireStats.expiredSubkeys != 1 {
+		t.Errorf("expiredSubkeys = %d, want 1", status.expireStats.expiredSubkeys)
+	}
+
+	// Hashes left without field TTLs are no longer tracked
+	if len(db.hashFieldExpires) != 0 {
+		t.Errorf("%d hashes still tracked, want 0", len(db.hashFieldExpires))
+	}
+}
+
+func TestExpiredKeysAreAbsent(t *testing.T) {
+	db := setupTestStore()
+	past := time.Now().Add(-time.Second)
+
+	db.stringStore["live"] = stringEntry{value: "v"}
+	db.stringStore["expired"] = stringEntry{value: "v"}
+	db.expires["expired"] = past
+	db.setStore["expiredSet"] = newMemberSet("m")
+	db.expires["expiredSet"] = past
+
+	rdb, err := encodeRDBFile(map[int]database{0: db})
+	if err != nil {
+		t.Fatalf("encodeRDBFile error = %v", err)
+	}
+
+	if bytes.Contains(rdb, []byte("expired")) {
+		t.Errorf("RDB file contains expired keys")
+	}
+
+	got, _ := keys(db, []string{"*"})
+	if string(got) != string(encodeRespStringArray([]string{"live"})) {
+		t.Errorf("keys(*) = %q, want only live", got)
+	}
+
+	db.stringStore["expired"] = stringEntry{value: "v"}
+	db.expires["expired"] = past
+
+	got, _ = typeFunc(db, []string{"expired"})
+	if string(got) != string(encodeRespSimpleString("none")) {
+		t.Errorf("type(expired) = %q, want none", got)
+	}
+
+	db.stringStore["expired"] = stringEntry{value: "v"}
+	db.expires["expired"] = past
+
+	got, _ = del(db, []string{"expired", "live"})
+	if string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("del(expired, live) = %q, want 1", got)
+	}
+}
+
+func TestEmptiedKeysDoNotLeaveTheirTTLBehind(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(db database)
+		empty  func(db database)
+	}{
+		{
+			"getdel",
+			func(db database) { set(db, []string{"k", "v"}) },
+			func(db database) { getdel(db, []string{"k"}) },
+		},
+		{
+			"rpop",
+			func(db database) { rpush(db, []string{"k", "a"}) },
+			func(db database) { rpop(db, []string{"k"}) },
+		},
+		{
+			"lrem",
+			func(db database) { rpush(db, []string{"k", "a"}) },
+			func(db database) { lrem(db, []string{"k", "0", "a"}) },
+		},
+		{
+			"ltrim",
+			func(db database) { rpush(db, []string{"k", "a"}) },
+			func(db database) { ltrim(db, []string{"k", "1", "0"}) },
+		},
+		{
+			"hdel",
+			func(db database) { hset(db, []string{"k", "f", "v"}) },
+			func(db database) { hdel(db, []string{"k", "f"}) },
+		},
+		{
+			"hexpire in the past",
+			func(db database) { hset(db, []string{"k", "f", "v"}) },
+			func(db database) {
+				hexpire(db, []string{"k", "0", "FIELDS", "1", "f"}, "hexpire", time.Second, false)
+			},
+		},
+		{
+			"srem",
+			func(db database) { sadd(db, []string{"k", "m"}) },
+			func(db database) { srem(db, []string{"k", "m"}) },
+		},
+		{
+			"spop",
+			func(db database) { sadd(db, []string{"k", "m"}) },
+			func(db database) { spop(db, []string{"k"}) },
+		},
+		{
+			"zrem",
+			func(db database) { zadd(db, []string{"k", "1", "m"}) },
+			func(db database) { zrem(db, []string{"k", "m"}) },
+		},
+		{
+			"zpopmin",
+			func(db database) { zadd(db, []string{"k", "1", "m"}) },
+			func(db database) { zpop(db, []string{"k"}, false) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestStore()
+			tt.create(db)
+			expire(db, []string{"k", "100"}, "expire", time.Second, false)
+
+			tt.empty(db)
+			if db.keyExists("k") {
+				t.Fatalf("emptied key still exists")
+			}
+
+			// A new key under the same name starts without a TTL
+			lpush(db, []string{"k", "a"})
+
+			got, _ := ttl(db, []string{"k"}, time.Second, false)
+			if string(got) != string(encodeRespInteger(-1)) {
+				t.Errorf("ttl of the new key = %q, want -1", got)
+			}
+		})
+	}
+}
+
+func TestReplicasLeaveExpiredKeysToTheirMaster(t *testing.T) {
+	db := setupTestStore()
+	status.replicaof = "localhost 6379"
+	defer func() { status.replicaof = "" }()
+
+	set(db, []string{"k", "v"})
+	sadd(db, []string{"s", "m"})
+	db.expires["k"] = time.Now().Add(-time.Second)
+	db.expires["s"] = time.Now().Add(-time.Second)
+
+	if got, _ := get(db, []string{"k"}); string(got) != "$-1\r\n" {
+		t.Errorf("get of an expired key = %q, want a null reply", got)
+	}
+
+	if got, _ := smembers(db, []string{"s"}); string(got) != "*0\r\n" {
+		t.Errorf("smembers of an expired key = %q, want an empty array", got)
+	}
+
+	if got, _ := ttl(db, []string{"k"}, time.Second, false); string(got) != string(encodeRespInteger(-2)) {
+		t.Errorf("ttl of an expired key = %q, want -2", got)
+	}
+
+	if _, ok := db.stringStore["k"]; !ok {
+		t.Fatalf("replica deleted an expired key on its own")
+	}
+
+	// The master may not consider the key expired yet
+	status.inMasterCommand = true
+	got, _ := get(db, []string{"k"})
+	status.inMasterCommand = false
+	if string(got) != string(encodeRespBulkString("v")) {
+		t.Errorf("get of an expired key from the master = %q, want v", got)
+	}
+
+	status.inMasterCommand = true
+	del(db, []string{"k"})
+	status.inMasterCommand = false
+	if _, ok := db.stringStore["k"]; ok {
+		t.Errorf("key still stored after the DEL of the master")
+	}
+}
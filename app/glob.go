@@ -0,0 +1,113 @@
+package main
+
+// globMatch reports whether `s` matches the glob-style `pattern`, with the
+// same semantics as Redis' stringmatchlen, shared by every command taking a
+// pattern:
+//   - `*` matches any sequence of bytes, including an empty one
+//   - `?` matches a single byte
+//   - `[abc]`, `[^abc]` and `[a-z]` match a single byte of, or not of, a set
+//   - `\x` matches x literally, including inside brackets
+//
+// Matching is done on bytes rather than runes, like Redis. On a mismatch,
+// only the last `*` is backtracked to, as every other token matches exactly
+// one byte. This bounds matching to O(len(pattern) * len(s)) where a naive
+// recursion is exponential in the number of stars.
+func globMatch(pattern string, s string) bool {
+	p, i := 0, 0
+	// Where to resume after a mismatch: right after the last star, with the
+	// star absorbing one more byte
+	starP, starI := -1, 0
+
+	for i < len(s) || p < len(pattern) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starI = p, i
+				p++
+				continue
+			case '?':
+				if i < len(s) {
+					p++
+					i++
+					continue
+				}
+			case '[':
+				if i < len(s) {
+					matched, rest := matchGlobClass(pattern[p+1:], s[i])
+					if matched {
+						p = len(pattern) - len(rest)
+						i++
+						continue
+					}
+				}
+			default:
+				literal := p
+				if pattern[p] == '\\' && p+1 < len(pattern) {
+					literal++
+				}
+
+				if i < len(s) && pattern[literal] == s[i] {
+					p = literal + 1
+					i++
+					continue
+				}
+			}
+		}
+
+		if starP >= 0 && starI < len(s) {
+			starI++
+			p, i = starP+1, starI
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// matchGlobClass matches c against the bracket expression starting right
+// after `[`. It returns whether c belongs to the class, and the pattern left
+// after the closing `]`. Like Redis, an unterminated class extends to the end
+// of the pattern.
+func matchGlobClass(pattern string, c byte) (bool, string) {
+	negate := false
+	matched := false
+
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	for len(pattern) > 0 && pattern[0] != ']' {
+		if pattern[0] == '\\' && len(pattern) >= 2 {
+			pattern = pattern[1:]
+
+			if pattern[0] == c {
+				matched = true
+			}
+		} else if len(pattern) >= 3 && pattern[1] == '-' {
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+
+			if c >= start && c <= end {
+				matched = true
+			}
+
+			pattern = pattern[2:]
+		} else if pattern[0] == c {
+			matched = true
+		}
+
+		pattern = pattern[1:]
+	}
+
+	if len(pattern) > 0 {
+		// Skip the closing bracket
+		pattern = pattern[1:]
+	}
+
+	return matched != negate, pattern
+}
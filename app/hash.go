@@ -0,0 +1,747 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields with a TTL also have an entry in `expires`, so that expired fields
+// can be found without going through the whole hash. Fields are set and
+// deleted through set and delete, which keep the scan index up to date.
+type hash struct {
+	fields    map[string]string
+	expires   map[string]time.Time
+	scanIndex *scanIndex
+}
+
+func newHash() *hash {
+	return &hash{
+		fields:    make(map[string]string),
+		expires:   make(map[string]time.Time),
+		scanIndex: newScanIndex(),
+	}
+}
+
+// set stores value in field, leaving its TTL alone.
+func (h *hash) set(field string, value string) {
+	if _, ok := h.fields[field]; !ok {
+		h.scanIndex.insert(field)
+	}
+
+	h.fields[field] = value
+}
+
+// delete removes field and its TTL.
+func (h *hash) delete(field string) {
+	delete(h.fields, field)
+	delete(h.expires, field)
+	h.scanIndex.remove(field)
+}
+
+func (h *hash) clone() *hash {
+	copied := newHash()
+	for field, value := range h.fields {
+		copied.set(field, value)
+	}
+	copied.expires = maps.Clone(h.expires)
+
+	return copied
+}
+
+// expired reports whether the TTL of field elapsed. Expired fields stay in
+// the hash until the master deletes them, commands only skipping them, and
+// commands received from the master still see them on replicas.
+func (h *hash) expired(field string, now time.Time) bool {
+	expiresAt, ok := h.expires[field]
+	return ok && !expiresAt.After(now) && !status.inMasterCommand
+}
+
+// get returns the value of field, unless it does not exist or expired.
+func (h *hash) get(field string, now time.Time) (string, bool) {
+	value, ok := h.fields[field]
+	if !ok || h.expired(field, now) {
+		return "", false
+	}
+
+	return value, true
+}
+
+// forEach calls f with every field that has not expired, and its value.
+func (h *hash) forEach(now time.Time, f func(field string, value string)) {
+	for field, value := range h.fields {
+		if !h.expired(field, now) {
+			f(field, value)
+		}
+	}
+}
+
+// len returns the number of fields that have not expired.
+func (h *hash) len(now time.Time) int {
+	n := len(h.fields)
+	for field := range h.expires {
+		if h.expired(field, now) {
+			n--
+		}
+	}
+
+	return n
+}
+
+// allExpired reports whether every field of the hash expired. It returns at
+// the first field found alive, at once if some fields have no TTL.
+func (h *hash) allExpired(now time.Time) bool {
+	if len(h.expires) < len(h.fields) {
+		return false
+	}
+
+	for field := range h.expires {
+		if !h.expired(field, now) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expireHashField deletes field if it expired, replicating it as an HDEL, so
+// that a command about to write it does the same on replicas, which still
+// hold the field.
+func expireHashField(db database, key string, h *hash, field string, now time.Time) {
+	if status.replicaof != "" || !h.expired(field, now) {
+		return
+	}
+
+	h.delete(field)
+	propagate(db, "HDEL", key, field)
+	status.expireStats.expiredSubkeys++
+}
+
+// expireHashFields deletes the fields of the hash stored at key whose TTL
+// elapsed, and the key itself once no field is left.
+// Replicas are told about it with an HDEL.
+func expireHashFields(db database, key string, h *hash, now time.Time) int {
+	expired := make([]string, 0)
+
+	for field := range h.expires {
+		if h.expired(field, now) {
+			expired = append(expired, field)
+		}
+	}
+
+	if len(expired) == 0 {
+		return 0
+	}
+
+	for _, field := range expired {
+		h.delete(field)
+	}
+
+	if len(h.fields) == 0 {
+		db.deleteKey(key)
+	}
+
+	propagate(db, append([]string{"HDEL", key}, expired...)...)
+	status.expireStats.expiredSubkeys += len(expired)
+
+	return len(expired)
+}
+
+// getHash returns the hash stored at key, nil if the key does not exist, or
+// ErrRespWrongType if the key holds another data type.
+// The hash may hold expired fields, which commands must skip.
+func getHash(db database, key string) (*hash, error) {
+	switch db.lookupKey(key) {
+	case "hash":
+		return db.hashStore[key], nil
+	case "none":
+		return nil, nil
+	}
+
+	return nil, ErrRespWrongType
+}
+
+func getOrCreateHash(db database, key string) (*hash, error) {
+	h, err := getHash(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		h = newHash()
+		db.hashStore[key] = h
+		db.keys.insert(key)
+	}
+
+	return h, nil
+}
+
+// hset removes the TTL of the fields it sets.
+func hset(db database, args []string) ([]byte, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	h, err := getOrCreateHash(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	added := 0
+	for i := 1; i+1 < len(args); i += 2 {
+		if _, ok := h.get(args[i], now); !ok {
+			added++
+		}
+
+		h.set(args[i], args[i+1])
+		delete(h.expires, args[i])
+	}
+
+	return encodeRespInteger(added), nil
+}
+
+// hsetnx sets field only if it does not exist yet.
+func hsetnx(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getOrCreateHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	expireHashField(db, args[0], h, args[1], time.Now())
+	if _, ok := h.fields[args[1]]; ok {
+		return encodeRespInteger(0), nil
+	}
+
+	h.set(args[1], args[2])
+
+	return encodeRespInteger(1), nil
+}
+
+func hget(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return []byte("$-1\r\n"), nil
+	}
+
+	value, ok := h.get(args[1], time.Now())
+	if !ok {
+		return []byte("$-1\r\n"), nil
+	}
+
+	return encodeRespBulkString(value), nil
+}
+
+func hmget(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		h = newHash()
+	}
+
+	now := time.Now()
+	values := make([][]byte, 0, len(args)-1)
+	for _, field := range args[1:] {
+		value, ok := h.get(field, now)
+		if !ok {
+			values = append(values, []byte("$-1\r\n"))
+			continue
+		}
+
+		values = append(values, encodeRespBulkString(value))
+	}
+
+	return encodeRespArray(values), nil
+}
+
+func hgetall(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return []byte("*0\r\n"), nil
+	}
+
+	fieldsAndValues := make([]string, 0, len(h.fields)*2)
+	h.forEach(time.Now(), func(field string, value string) {
+		fieldsAndValues = append(fieldsAndValues, field, value)
+	})
+
+	return encodeRespStringArray(fieldsAndValues), nil
+}
+
+func hdel(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	h, err := getHash(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	// Expired fields are deleted along, but not counted
+	now := time.Now()
+	deleted := 0
+	for _, field := range args[1:] {
+		if _, ok := h.get(field, now); ok {
+			deleted++
+		}
+
+		h.delete(field)
+	}
+
+	if len(h.fields) == 0 {
+		db.deleteKey(key)
+	}
+
+	return encodeRespInteger(deleted), nil
+}
+
+func hexists(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	if _, ok := h.get(args[1], time.Now()); ok {
+		return encodeRespInteger(1), nil
+	}
+
+	return encodeRespInteger(0), nil
+}
+
+// hincrby keeps the TTL of the field it increments.
+func hincrby(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	field := args[1]
+
+	increment, err := parseInteger(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := getOrCreateHash(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	expireHashField(db, key, h, field, time.Now())
+
+	current := 0
+	if value, ok := h.fields[field]; ok {
+		current, err = parseInteger(value)
+		if err != nil {
+			return nil, ErrRespHashValueNotInteger
+		}
+	}
+
+	if (increment > 0 && current > math.MaxInt-increment) ||
+		(increment < 0 && current < math.MinInt-increment) {
+		return nil, ErrRespIncrementOverflow
+	}
+
+	h.set(field, strconv.Itoa(current+increment))
+
+	return encodeRespInteger(current + increment), nil
+}
+
+// hincrbyfloat is replicated as an HSET of the resulting value so that
+// replicas never compute floats on their own. As HSET clears the TTL of the
+// field, it is replicated again if there is one.
+func hincrbyfloat(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	field := args[1]
+
+	increment, err := parseFloat(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if math.IsInf(increment, 0) {
+		return nil, ErrRespValueNaNOrInfinity
+	}
+
+	h, err := getOrCreateHash(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	expireHashField(db, key, h, field, time.Now())
+
+	current := 0.0
+	if value, ok := h.fields[field]; ok {
+		current, err = parseFloat(value)
+		if err != nil {
+			return nil, ErrRespHashValueNotFloat
+		}
+	}
+
+	result := current + increment
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, ErrRespIncrementNaNOrInfinity
+	}
+
+	h.set(field, formatFloat(result))
+	propagate(db, "HSET", key, field, h.fields[field])
+
+	if expiresAt, ok := h.expires[field]; ok {
+		propagate(db, "HPEXPIREAT", key, strconv.FormatInt(expiresAt.UnixMilli(), 10), "FIELDS", "1", field)
+	}
+
+	return encodeRespBulkString(h.fields[field]), nil
+}
+
+func hkeys(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return []byte("*0\r\n"), nil
+	}
+
+	fields := make([]string, 0, len(h.fields))
+	h.forEach(time.Now(), func(field string, _ string) {
+		fields = append(fields, field)
+	})
+
+	return encodeRespStringArray(fields), nil
+}
+
+func hvals(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return []byte("*0\r\n"), nil
+	}
+
+	values := make([]string, 0, len(h.fields))
+	h.forEach(time.Now(), func(_ string, value string) {
+		values = append(values, value)
+	})
+
+	return encodeRespStringArray(values), nil
+}
+
+func hlen(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	return encodeRespInteger(h.len(time.Now())), nil
+}
+
+func hscan(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	options, err := parseScanOptions(args[1], args[2:], false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := getHash(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return encodeScanReply(0, []string{}), nil
+	}
+
+	fields, cursor := scanCollection(options, h.scanIndex)
+
+	now := time.Now()
+	elements := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		if h.expired(field, now) {
+			continue
+		}
+
+		elements = append(elements, field)
+		if !options.noValues {
+			elements = append(elements, h.fields[field])
+		}
+	}
+
+	return encodeScanReply(cursor, elements), nil
+}
+
+// parseFieldsArgument parses the `FIELDS numfields field [field ...]`
+// argument closing the field expiration commands.
+func parseFieldsArgument(args []string) ([]string, error) {
+	if len(args) < 2 || !strings.EqualFold(args[0], "FIELDS") {
+		return nil, ErrRespFieldsArgumentMissing
+	}
+
+	numFields, err := parseInteger(args[1])
+	if err != nil || numFields <= 0 {
+		return nil, ErrRespNumFieldsNotPositive
+	}
+
+	if numFields != len(args)-2 {
+		return nil, ErrRespNumFieldsMismatch
+	}
+
+	return args[2:], nil
+}
+
+// hexpire implements HEXPIRE, HPEXPIRE, HEXPIREAT and HPEXPIREAT, which only
+// differ by the unit of the expiry and whether it is relative to now.
+// For every field it replies
+// -2 if the field does not exist,
+// 0 if the NX | XX | GT | LT condition is not met,
+// 1 if the TTL was set,
+// 2 if the field was deleted because the expiry is in the past.
+// It is replicated as an HPEXPIREAT, so that replicas don't compute the
+// expiry relative to their own clock, and an HDEL for deleted fields.
+func hexpire(db database, args []string, commandName string, unit time.Duration, absolute bool) ([]byte, error) {
+	if len(args) < 4 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	now := time.Now()
+
+	expiry, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if expiry < 0 {
+		return nil, errInvalidExpireTime(commandName)
+	}
+
+	expiresAt, err := expiryTime(expiry, unit, absolute, now)
+	if err != nil {
+		return nil, errInvalidExpireTime(commandName)
+	}
+
+	options := args[2:]
+	var condition expiryCondition
+	if !strings.EqualFold(options[0], "FIELDS") {
+		if !condition.parse(options[0]) {
+			return nil, ErrRespFieldsArgumentMissing
+		}
+
+		options = options[1:]
+	}
+
+	fields, err := parseFieldsArgument(options)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := getHash(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		h = newHash()
+	}
+
+	results := make([]int, 0, len(fields))
+	updated := make([]string, 0)
+	deleted := make([]string, 0)
+
+	for _, field := range fields {
+		if _, ok := h.get(field, now); !ok {
+			results = append(results, -2)
+			continue
+		}
+
+		current, hasTTL := h.expires[field]
+
+		if !condition.allows(expiresAt, current, hasTTL) {
+			results = append(results, 0)
+			continue
+		}
+
+		if !expiresAt.After(now) {
+			h.delete(field)
+			deleted = append(deleted, field)
+			results = append(results, 2)
+			continue
+		}
+
+		h.expires[field] = expiresAt
+		updated = append(updated, field)
+		results = append(results, 1)
+	}
+
+	if len(h.fields) == 0 {
+		db.deleteKey(key)
+	}
+
+	if len(updated) > 0 {
+		db.hashFieldExpires[key] = struct{}{}
+		propagated := []string{"HPEXPIREAT", key, strconv.FormatInt(expiresAt.UnixMilli(), 10), "FIELDS", strconv.Itoa(len(updated))}
+		propagate(db, append(propagated, updated...)...)
+	}
+
+	if len(deleted) > 0 {
+		propagate(db, append([]string{"HDEL", key}, deleted...)...)
+	}
+
+	return encodeRespIntegerArray(results), nil
+}
+
+// httl implements HTTL, HPTTL, HEXPIRETIME and HPEXPIRETIME. For every field
+// it replies -2 if the field does not exist, -1 if it has no TTL, and its
+// TTL or expiry timestamp otherwise.
+func httl(db database, args []string, unit time.Duration, absolute bool) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	fields, err := parseFieldsArgument(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		h = newHash()
+	}
+
+	now := time.Now()
+	results := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if _, ok := h.get(field, now); !ok {
+			results = append(results, -2)
+			continue
+		}
+
+		expiresAt, ok := h.expires[field]
+		if !ok {
+			results = append(results, -1)
+			continue
+		}
+
+		results = append(results, formatExpiry(expiresAt, unit, absolute, now))
+	}
+
+	return encodeRespIntegerArray(results), nil
+}
+
+// hpersist replies for every field -2 if the field does not exist, -1 if it
+// has no TTL and 1 if its TTL was removed.
+func hpersist(db database, args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	fields, err := parseFieldsArgument(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := getHash(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		h = newHash()
+	}
+
+	now := time.Now()
+	results := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if _, ok := h.get(field, now); !ok {
+			results = append(results, -2)
+			continue
+		}
+
+		if _, ok := h.expires[field]; !ok {
+			results = append(results, -1)
+			continue
+		}
+
+		delete(h.expires, field)
+		results = append(results, 1)
+	}
+
+	return encodeRespIntegerArray(results), nil
+}
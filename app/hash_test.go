@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// sortedStrings decodes an array reply of bulk strings and sorts it, as
+// hashes reply in no particular order.
+func sortedStrings(t *testing.T, reply []byte) []string {
+	t.Helper()
+
+	q, err := readResp(bufio.NewReader(bytes.NewReader(reply)))
+	if err != nil {
+		t.Fatalf("decoding %q: %v", reply, err)
+	}
+
+	array, _ := q.asArray()
+	elements := make([]string, 0, len(array))
+	for _, element := range array {
+		s, _ := element.asString()
+		elements = append(elements, s)
+	}
+
+	slices.Sort(elements)
+	return elements
+}
+
+func TestHIncrBy(t *testing.T) {
+	db := setupTestStore()
+	hset(db, []string{"h", "n", "9223372036854775806", "s", "abc"})
+
+	tests := []struct {
+		args []string
+		want []byte
+		err  error
+	}{
+		{args: []string{"h", "n", "1"}, want: encodeRespInteger(9223372036854775807)},
+		{args: []string{"h", "n", "1"}, err: ErrRespIncrementOverflow},
+		{args: []string{"h", "new", "-5"}, want: encodeRespInteger(-5)},
+		{args: []string{"h", "new", "-9223372036854775804"}, err: ErrRespIncrementOverflow},
+		{args: []string{"h", "s", "1"}, err: ErrRespHashValueNotInteger},
+		{args: []string{"h", "n", "x"}, err: ErrRespNotInteger},
+	}
+
+	for _, tt := range tests {
+		got, err := hincrby(db, tt.args)
+		if err != tt.err {
+			t.Errorf("hincrby(%v) error = %v, want %v", tt.args, err, tt.err)
+			continue
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("hincrby(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	if got, _ := hget(db, []string{"h", "n"}); string(got) != string(encodeRespBulkString("9223372036854775807")) {
+		t.Errorf("field after a failed hincrby = %q", got)
+	}
+}
+
+func TestHIncrByFloat(t *testing.T) {
+	db := setupTestStore()
+	hset(db, []string{"h", "f", "10.50", "s", "abc"})
+
+	tests := []struct {
+		args []string
+		want string
+		err  error
+	}{
+		{args: []string{"h", "f", "0.1"}, want: "10.6"},
+		{args: []string{"h", "f", "-5.6"}, want: "5"},
+		{args: []string{"h", "f", "5.0e3"}, want: "5005"},
+		{args: []string{"h", "new", "1.5"}, want: "1.5"},
+		{args: []string{"h", "s", "1"}, err: ErrRespHashValueNotFloat},
+		{args: []string{"h", "f", "inf"}, err: ErrRespValueNaNOrInfinity},
+	}
+
+	for _, tt := range tests {
+		got, err := hincrbyfloat(db, tt.args)
+		if err != tt.err {
+			t.Errorf("hincrbyfloat(%v) error = %v, want %v", tt.args, err, tt.err)
+			continue
+		}
+
+		if tt.err == nil && string(got) != string(encodeRespBulkString(tt.want)) {
+			t.Errorf("hincrbyfloat(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestHashReadCommands(t *testing.T) {
+	db := setupTestStore()
+	hset(db, []string{"h", "a", "1", "b", "2", "c", "3"})
+
+	got, _ := hgetall(db, []string{"h"})
+	if want := []string{"1", "2", "3", "a", "b", "c"}; !slices.Equal(sortedStrings(t, got), want) {
+		t.Errorf("hgetall = %q, want fields and values %v", got, want)
+	}
+
+	got, _ = hkeys(db, []string{"h"})
+	if want := []string{"a", "b", "c"}; !slices.Equal(sortedStrings(t, got), want) {
+		t.Errorf("hkeys = %q, want %v", got, want)
+	}
+
+	got, _ = hvals(db, []string{"h"})
+	if want := []string{"1", "2", "3"}; !slices.Equal(sortedStrings(t, got), want) {
+		t.Errorf("hvals = %q, want %v", got, want)
+	}
+
+	for _, f := range []func(database, []string) ([]byte, error){hgetall, hkeys, hvals} {
+		if got, _ := f(db, []string{"missing"}); string(got) != "*0\r\n" {
+			t.Errorf("reply for a missing key = %q, want an empty array", got)
+		}
+	}
+
+	db.stringStore["s"] = stringEntry{value: "v"}
+	for _, f := range []func(database, []string) ([]byte, error){hgetall, hkeys, hvals, hlen} {
+		if _, err := f(db, []string{"s"}); err != ErrRespWrongType {
+			t.Errorf("reply for a string error = %v, want %v", err, ErrRespWrongType)
+		}
+	}
+}
+
+func TestHSetNX(t *testing.T) {
+	db := setupTestStore()
+
+	if got, _ := hsetnx(db, []string{"h", "f", "first"}); string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("hsetnx on a new field = %q, want 1", got)
+	}
+
+	if got, _ := hsetnx(db, []string{"h", "f", "second"}); string(got) != string(encodeRespInteger(0)) {
+		t.Errorf("hsetnx on an existing field = %q, want 0", got)
+	}
+
+	if got, _ := hget(db, []string{"h", "f"}); string(got) != string(encodeRespBulkString("first")) {
+		t.Errorf("field after hsetnx = %q, want first", got)
+	}
+
+	db.stringStore["s"] = stringEntry{value: "v"}
+	if _, err := hsetnx(db, []string{"s", "f", "v"}); err != ErrRespWrongType {
+		t.Errorf("hsetnx on a string error = %v, want %v", err, ErrRespWrongType)
+	}
+}
+
+func TestHashFieldExpiry(t *testing.T) {
+	db := setupTestStore()
+	hset(db, []string{"h", "a", "1", "b", "2"})
+
+	got, _ := hexpire(db, []string{"h", "100", "FIELDS", "2", "a", "missing"}, "hexpire", time.Second, false)
+	if want := encodeRespIntegerArray([]int{1, -2}); string(got) != string(want) {
+		t.Errorf("hexpire = %q, want %q", got, want)
+	}
+
+	got, _ = hexpire(db, []string{"h", "50", "GT", "FIELDS", "1", "a"}, "hexpire", time.Second, false)
+	if want := encodeRespIntegerArray([]int{0}); string(got) != string(want) {
+		t.Errorf("hexpire GT with a smaller TTL = %q, want %q", got, want)
+	}
+
+	got, _ = httl(db, []string{"h", "FIELDS", "2", "a", "b"}, time.Second, false)
+	if want := encodeRespIntegerArray([]int{100, -1}); string(got) != string(want) {
+		t.Errorf("httl = %q, want %q", got, want)
+	}
+
+	got, _ = hpersist(db, []string{"h", "FIELDS", "3", "a", "b", "missing"})
+	if want := encodeRespIntegerArray([]int{1, -1, -2}); string(got) != string(want) {
+		t.Errorf("hpersist = %q, want %q", got, want)
+	}
+
+	got, _ = httl(db, []string{"h", "FIELDS", "1", "a"}, time.Second, false)
+	if want := encodeRespIntegerArray([]int{-1}); string(got) != string(want) {
+		t.Errorf("httl after hpersist = %q, want %q", got, want)
+	}
+
+	// Setting a field clears its TTL
+	hexpire(db, []string{"h", "100", "FIELDS", "1", "a"}, "hexpire", time.Second, false)
+	hset(db, []string{"h", "a", "3"})
+	got, _ = httl(db, []string{"h", "FIELDS", "1", "a"}, time.Second, false)
+	if want := encodeRespIntegerArray([]int{-1}); string(got) != string(want) {
+		t.Errorf("httl after hset = %q, want %q", got, want)
+	}
+
+	// The key goes away with its last field
+	h := db.hashStore["h"]
+	h.expires["a"] = time.Now().Add(-time.Second)
+	if got, _ := hlen(db, []string{"h"}); string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("hlen after a field expired = %q, want 1", got)
+	}
+
+	got, _ = hexpire(db, []string{"h", "0", "FIELDS", "1", "b"}, "hexpire", time.Second, false)
+	if want := encodeRespIntegerArray([]int{2}); string(got) != string(want) {
+		t.Errorf("hexpire in the past = %q, want %q", got, want)
+	}
+
+	if db.keyExists("h") {
+		t.Errorf("hash without fields still exists")
+	}
+
+	hset(db, []string{"h", "a", "1"})
+	db.hashStore["h"].expires["a"] = time.Now().Add(-time.Second)
+	if typ := db.lookupKey("h"); typ != "none" {
+		t.Errorf("type of a hash whose fields all expired = %q, want none", typ)
+	}
+}
+
+func TestExpiredFieldsAreSkipped(t *testing.T) {
+	for _, replica := range []bool{false, true} {
+		db := setupTestStore()
+		if replica {
+			status.replicaof = "localhost 6379"
+		}
+
+		hset(db, []string{"h", "live", "1", "expired", "2"})
+		db.hashStore["h"].expires["expired"] = time.Now().Add(-time.Second)
+
+		tests := []struct {
+			name string
+			f    func(database, []string) ([]byte, error)
+			args []string
+			want []byte
+		}{
+			{"hget", hget, []string{"h", "expired"}, []byte("$-1\r\n")},
+			{"hmget", hmget, []string{"h", "live", "expired"}, encodeRespArray([][]byte{encodeRespBulkString("1"), []byte("$-1\r\n")})},
+			{"hexists", hexists, []string{"h", "expired"}, encodeRespInteger(0)},
+			{"hlen", hlen, []string{"h"}, encodeRespInteger(1)},
+			{"hgetall", hgetall, []string{"h"}, encodeRespStringArray([]string{"live", "1"})},
+			{"hkeys", hkeys, []string{"h"}, encodeRespStringArray([]string{"live"})},
+			{"hvals", hvals, []string{"h"}, encodeRespStringArray([]string{"1"})},
+			{"hscan", hscan, []string{"h", "0"}, encodeScanReply(0, []string{"live", "1"})},
+		}
+
+		for _, tt := range tests {
+			got, err := tt.f(db, tt.args)
+			if err != nil {
+				t.Fatalf("%s(%v) error = %v", tt.name, tt.args, err)
+			}
+
+			if string(got) != string(tt.want) {
+				t.Errorf("%s(%v) on a replica: %t = %q, want %q", tt.name, tt.args, replica, got, tt.want)
+			}
+		}
+
+		// Reads leave the expired field to the master
+		if _, ok := db.hashStore["h"].fields["expired"]; !ok {
+			t.Errorf("reads deleted the expired field, on a replica: %t", replica)
+		}
+
+		status.replicaof = ""
+	}
+}
+
+func TestWritesReplaceExpiredFields(t *testing.T) {
+	setupTestStore()
+	replicaEnd := connectTestReplica()
+	conn := newTestClient()
+	past := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+
+	// A live field keeps the hash from being deleted as a whole
+	runCommand(conn, "HSET", "h", "a", "1", "b", "2", "c", "3", "live", "v")
+	db := status.databases[0]
+	for _, field := range []string{"a", "b", "c"} {
+		db.hashStore["h"].expires[field] = time.Now().Add(-time.Second)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"HSETNX", "h", "a", "new"}, string(encodeRespInteger(1))},
+		{[]string{"HINCRBY", "h", "b", "5"}, string(encodeRespInteger(5))},
+		{[]string{"HSET", "h", "c", "new"}, string(encodeRespInteger(1))},
+		{[]string{"HPEXPIREAT", "h", past, "FIELDS", "1", "missing"}, string(encodeRespIntegerArray([]int{-2}))},
+	}
+
+	for _, tt := range tests {
+		if got := runCommand(conn, tt.args...); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	got, _ := httl(db, []string{"h", "FIELDS", "3", "a", "b", "c"}, time.Second, false)
+	if want := encodeRespIntegerArray([]int{-1, -1, -1}); string(got) != string(want) {
+		t.Errorf("httl of the replaced fields = %q, want %q", got, want)
+	}
+
+	// Replicas delete the expired field before applying the write, as they
+	// do not expire fields on their own
+	stream := []string{"SELECT 0", "HSET h a 1 b 2 c 3 live v", "HDEL h a", "HSETNX h a new", "HDEL h b", "HINCRBY h b 5", "HSET h c new"}
+	if got := readReplicationStream(t, replicaEnd, stream); got != nil {
+		t.Errorf("replication stream = %v, want %v", got, stream)
+	}
+}
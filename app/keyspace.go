@@ -0,0 +1,393 @@
+package main
+
+import (
+	"container/list"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// Type agnostic key management commands. They work on any store of a
+// database, and keep the TTL of the keys they rename, copy or move.
+
+// getDatabase returns the database numbered `index`, creating it on first
+// use. It fails if `index` is not below the `databases` setting.
+func getDatabase(index int) (database, error) {
+	if index < 0 || index >= status.databaseCount {
+		return database{}, ErrRespDBIndexOutOfRange
+	}
+
+	db, ok := status.databases[index]
+	if !ok {
+		db = newDatabase(index)
+		status.databases[index] = db
+	}
+
+	return db, nil
+}
+
+func parseDatabaseIndex(s string) (database, error) {
+	index, err := parseInteger(s)
+	if err != nil {
+		return database{}, err
+	}
+
+	return getDatabase(index)
+}
+
+// copyValue stores the value and TTL of `key` to `dstKey` in `dst`, which
+// must not exist. When `move` is set, the value is handed over rather than
+// cloned, and `key` is deleted. Blocked clients waiting on the destination
+// are signaled, as it may now hold a list or a sorted set.
+func (db database) copyValue(key string, dst database, dstKey string, move bool) {
+	if entry, ok := db.stringStore[key]; ok {
+		dst.stringStore[dstKey] = entry
+	}
+
+	if s, ok := db.streamStore[key]; ok {
+		if !move {
+			// Entries are never modified once added, so they can be
+			// shared
+			s = stream{
+				entries:      slices.Clone(s.entries),
+				lastID:       s.lastID,
+				groups:       cloneConsumerGroups(s.groups),
+				entriesAdded: s.entriesAdded,
+				maxDeletedID: s.maxDeletedID,
+			}
+		}
+
+		dst.streamStore[dstKey] = s
+	}
+
+	if l, ok := db.listStore[key]; ok {
+		if !move {
+			copied := list.New()
+			copied.PushBackList(l)
+			l = copied
+		}
+
+		dst.listStore[dstKey] = l
+	}
+
+	if h, ok := db.hashStore[key]; ok {
+		if !move {
+			h = h.clone()
+		}
+
+		dst.hashStore[dstKey] = h
+		if len(h.expires) > 0 {
+			dst.hashFieldExpires[dstKey] = struct{}{}
+		}
+	}
+
+	if s, ok := db.setStore[key]; ok {
+		if !move {
+			s = s.clone()
+		}
+
+		dst.setStore[dstKey] = s
+	}
+
+	if z, ok := db.sortedSetStore[key]; ok {
+		if !move {
+			copied := newSortedSet()
+			for member, score := range z.scores {
+				copied.add(member, score)
+			}
+			z = copied
+		}
+
+		dst.sortedSetStore[dstKey] = z
+	}
+
+	dst.keys.insert(dstKey)
+
+	if expiresAt, ok := db.expires[key]; ok {
+		dst.expires[dstKey] = expiresAt
+	}
+
+	if move {
+		db.deleteKey(key)
+	}
+
+	signalKeyAsReady(dst, dstKey)
+}
+
+func exists(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	// Keys given several times are counted several times, like Redis
+	count := 0
+	for _, key := range args {
+		if db.keyExists(key) {
+			count++
+		}
+	}
+
+	return encodeRespInteger(count), nil
+}
+
+// rename implements RENAME, and RENAMENX when `nx` is set, in which case
+// nothing happens if the new key already exists.
+func rename(db database, args []string, nx bool) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	newKey := args[1]
+
+	if !db.keyExists(key) {
+		return nil, ErrRespNoSuchKey
+	}
+
+	if key == newKey {
+		if nx {
+			return encodeRespInteger(0), nil
+		}
+
+		return []byte("+OK\r\n"), nil
+	}
+
+	if nx {
+		if db.keyExists(newKey) {
+			return encodeRespInteger(0), nil
+		}
+	} else {
+		db.deleteKey(newKey)
+	}
+
+	db.copyValue(key, db, newKey, true)
+
+	if nx {
+		return encodeRespInteger(1), nil
+	}
+
+	return []byte("+OK\r\n"), nil
+}
+
+// copyFunc implements COPY source destination [DB destination-db] [REPLACE].
+func copyFunc(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	dstKey := args[1]
+	dst := db
+	replace := false
+
+	options := args[2:]
+	for i := 0; i < len(options); i++ {
+		if strings.EqualFold(options[i], "DB") && i+1 < len(options) {
+			var err error
+			dst, err = parseDatabaseIndex(options[i+1])
+			if err != nil {
+				return nil, err
+			}
+			i++
+		} else if strings.EqualFold(options[i], "REPLACE") {
+			replace = true
+		} else {
+			return nil, ErrRespSyntax
+		}
+	}
+
+	if dst.id == db.id && key == dstKey {
+		return nil, ErrRespSameObject
+	}
+
+	if !db.keyExists(key) {
+		return encodeRespInteger(0), nil
+	}
+
+	if dst.keyExists(dstKey) {
+		if !replace {
+			return encodeRespInteger(0), nil
+		}
+
+		dst.deleteKey(dstKey)
+	}
+
+	db.copyValue(key, dst, dstKey, false)
+
+	return encodeRespInteger(1), nil
+}
+
+// move moves a key to another database. It replies 0, leaving both
+// databases untouched, if the key does not exist or already exists in the
+// destination.
+func move(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	dst, err := parseDatabaseIndex(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if dst.id == db.id {
+		return nil, ErrRespSameObject
+	}
+
+	if !db.keyExists(key) || dst.keyExists(key) {
+		return encodeRespInteger(0), nil
+	}
+
+	db.copyValue(key, dst, key, true)
+
+	return encodeRespInteger(1), nil
+}
+
+// randomkey replies a random key, or a null bulk string if the database is
+// empty. Expired keys drawn along the way are reclaimed and drawn again.
+func randomkey(db database, args []string) ([]byte, error) {
+	if len(args) != 0 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	keys := make([]string, 0)
+	db.forEachKey(func(key string) {
+		keys = append(keys, key)
+	})
+
+	for len(keys) > 0 {
+		i := rand.Intn(len(keys))
+		if db.keyExists(keys[i]) {
+			return encodeRespBulkString(keys[i]), nil
+		}
+
+		keys[i] = keys[len(keys)-1]
+		keys = keys[:len(keys)-1]
+	}
+
+	return []byte("$-1\r\n"), nil
+}
+
+// dbsize replies the number of keys, counting expired keys that were not
+// reclaimed yet, like Redis.
+func dbsize(db database, args []string) ([]byte, error) {
+	if len(args) != 0 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	count := 0
+	db.forEachKey(func(key string) {
+		count++
+	})
+
+	return encodeRespInteger(count), nil
+}
+
+// touch replies the number of existing keys. Access times are not tracked,
+// so it only has the side effect of reclaiming expired keys.
+func touch(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	count := 0
+	for _, key := range args {
+		if db.keyExists(key) {
+			count++
+		}
+	}
+
+	return encodeRespInteger(count), nil
+}
+
+// checkFlushMode validates the optional ASYNC | SYNC argument of FLUSHDB
+// and FLUSHALL. Both modes behave the same: the old stores are dropped and
+// left to the garbage collector, which reclaims them in the background, so
+// a flush returns as soon as the databases are replaced, with their memory
+// not necessarily freed yet.
+func checkFlushMode(args []string) error {
+	if len(args) > 1 {
+		return ErrRespWrongNumberOfArguments
+	}
+
+	if len(args) == 0 || strings.EqualFold(args[0], "SYNC") || strings.EqualFold(args[0], "ASYNC") {
+		return nil
+	}
+
+	return ErrRespSyntax
+}
+
+// flushDatabases replaces the given databases with empty ones.
+func flushDatabases(indexes []int) {
+	for _, index := range indexes {
+		status.databases[index] = newDatabase(index)
+	}
+}
+
+func flushdb(db database, args []string) ([]byte, error) {
+	if err := checkFlushMode(args); err != nil {
+		return nil, err
+	}
+
+	flushDatabases([]int{db.id})
+
+	return []byte("+OK\r\n"), nil
+}
+
+func flushall(args []string) ([]byte, error) {
+	if err := checkFlushMode(args); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(status.databases))
+	for index := range status.databases {
+		indexes = append(indexes, index)
+	}
+
+	flushDatabases(indexes)
+
+	return []byte("+OK\r\n"), nil
+}
+
+// swapdb swaps the content of two databases, so that clients connected to
+// one immediately see the data of the other. Clients blocked on a key that
+// exists after the swap are served.
+func swapdb(args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	first, err := parseInteger(args[0])
+	if err != nil {
+		return nil, ErrRespInvalidFirstDBIndex
+	}
+
+	second, err := parseInteger(args[1])
+	if err != nil {
+		return nil, ErrRespInvalidSecondDBIndex
+	}
+
+	a, err := getDatabase(first)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := getDatabase(second)
+	if err != nil {
+		return nil, err
+	}
+
+	a.id, b.id = second, first
+	status.databases[first] = b
+	status.databases[second] = a
+
+	for _, db := range []database{a, b} {
+		for key := range status.blockedClients[db.id] {
+			signalKeyAsReady(db, key)
+		}
+	}
+
+	return []byte("+OK\r\n"), nil
+}
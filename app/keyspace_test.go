@@ -0,0 +1,105 @@
+package main
+
+import (
+	"container/list"
+	"testing"
+	"time"
+)
+
+func TestRenameCopyMove(t *testing.T) {
+	db := setupTestStore()
+	expiresAt := time.Now().Add(time.Hour)
+
+	db.setStore["s"] = newMemberSet("a")
+	db.expires["s"] = expiresAt
+
+	if _, err := rename(db, []string{"s", "renamed"}, false); err != nil {
+		t.Fatalf("rename error = %v", err)
+	}
+
+	if db.lookupKey("s") != "none" || db.lookupKey("renamed") != "set" {
+		t.Errorf("rename did not move the set")
+	}
+
+	if !db.expires["renamed"].Equal(expiresAt) {
+		t.Errorf("rename did not keep the TTL")
+	}
+
+	if _, err := rename(db, []string{"missing", "other"}, false); err != ErrRespNoSuchKey {
+		t.Errorf("rename of a missing key error = %v, want %v", err, ErrRespNoSuchKey)
+	}
+
+	got, _ := copyFunc(db, []string{"renamed", "copied", "DB", "1"})
+	if string(got) != string(encodeRespInteger(1)) {
+		t.Fatalf("copy to db 1 = %q, want 1", got)
+	}
+
+	other := status.databases[1]
+	other.setStore["copied"].add("b")
+	if db.setStore["renamed"].len() != 1 {
+		t.Errorf("copy shares its value with the source")
+	}
+
+	got, _ = copyFunc(db, []string{"renamed", "copied", "DB", "1"})
+	if string(got) != string(encodeRespInteger(0)) {
+		t.Errorf("copy onto an existing key without REPLACE = %q, want 0", got)
+	}
+
+	got, _ = move(db, []string{"renamed", "1"})
+	if string(got) != string(encodeRespInteger(1)) {
+		t.Fatalf("move to db 1 = %q, want 1", got)
+	}
+
+	if db.lookupKey("renamed") != "none" || other.lookupKey("renamed") != "set" {
+		t.Errorf("move did not move the set to db 1")
+	}
+
+	if _, err := move(other, []string{"renamed", "1"}); err != ErrRespSameObject {
+		t.Errorf("move to the same db error = %v, want %v", err, ErrRespSameObject)
+	}
+}
+
+func TestFlushAndSwapDatabases(t *testing.T) {
+	db := setupTestStore()
+	db.stringStore["a"] = stringEntry{value: "v"}
+	db.expires["a"] = time.Now().Add(time.Hour)
+
+	other, _ := getDatabase(1)
+	other.listStore["l"] = list.New()
+	other.listStore["l"].PushBack("x")
+
+	if _, err := swapdb([]string{"0", "1"}); err != nil {
+		t.Fatalf("swapdb error = %v", err)
+	}
+
+	if status.databases[0].lookupKey("l") != "list" || status.databases[1].lookupKey("a") != "string" {
+		t.Errorf("swapdb did not swap the content of the databases")
+	}
+
+	if status.databases[0].id != 0 || status.databases[1].id != 1 {
+		t.Errorf("swapdb did not keep the database ids in sync with their index")
+	}
+
+	if _, err := flushdb(status.databases[1], []string{"ASYNC"}); err != nil {
+		t.Fatalf("flushdb error = %v", err)
+	}
+
+	if status.databases[1].keyExists("a") || len(status.databases[1].expires) != 0 {
+		t.Errorf("flushdb left keys behind")
+	}
+
+	if !status.databases[0].keyExists("l") {
+		t.Errorf("flushdb flushed another database")
+	}
+
+	flushall(nil)
+	for index, db := range status.databases {
+		if db.keyExists("l") {
+			t.Errorf("flushall left keys behind in db %d", index)
+		}
+	}
+
+	if _, err := flushall([]string{"LATER"}); err != ErrRespSyntax {
+		t.Errorf("flushall LATER error = %v, want %v", err, ErrRespSyntax)
+	}
+}
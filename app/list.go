@@ -0,0 +1,854 @@
+package main
+
+import (
+	"container/list"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Lists are doubly linked lists so pushing and popping at either end is
+// O(1), which is what queue-like workloads rely on.
+// An empty list is never kept around: the key is deleted with its last element.
+
+// getList returns the list stored at key, nil if the key does not exist, or
+// ErrRespWrongType if the key holds another data type.
+func getList(db database, key string) (*list.List, error) {
+	switch db.lookupKey(key) {
+	case "list":
+		return db.listStore[key], nil
+	case "none":
+		return nil, nil
+	}
+
+	return nil, ErrRespWrongType
+}
+
+// listElementAt returns the element at `index`, which must be within
+// [0, l.Len()). The list is walked from whichever end is closer.
+func listElementAt(l *list.List, index int) *list.Element {
+	if index < l.Len()/2 {
+		e := l.Front()
+		for i := 0; i < index; i++ {
+			e = e.Next()
+		}
+		return e
+	}
+
+	e := l.Back()
+	for i := l.Len() - 1; i > index; i-- {
+		e = e.Prev()
+	}
+	return e
+}
+
+func listPush(db database, key string, elements []string, left bool) (int, error) {
+	l, err := getList(db, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if l == nil {
+		l = list.New()
+		db.listStore[key] = l
+		db.keys.insert(key)
+	}
+
+	for _, element := range elements {
+		if left {
+			l.PushFront(element)
+		} else {
+			l.PushBack(element)
+		}
+	}
+
+	signalKeyAsReady(db, key)
+
+	return l.Len(), nil
+}
+
+// listPop removes up to `count` elements from one end of the list stored at
+// key, deleting the key once the list is empty.
+func listPop(db database, key string, l *list.List, left bool, count int) []string {
+	popped := make([]string, 0, min(count, l.Len()))
+
+	for i := 0; i < count && l.Len() > 0; i++ {
+		e := l.Back()
+		if left {
+			e = l.Front()
+		}
+
+		popped = append(popped, l.Remove(e).(string))
+	}
+
+	if l.Len() == 0 {
+		db.deleteKey(key)
+	}
+
+	return popped
+}
+
+// listMove pops an element from one end of `source` and pushes it to one end
+// of `destination`. `ok` is false if source does not exist.
+func listMove(db database, source string, destination string, fromLeft bool, toLeft bool) (element string, ok bool, err error) {
+	sourceList, err := getList(db, source)
+	if err != nil {
+		return "", false, err
+	}
+
+	_, err = getList(db, destination)
+	if err != nil {
+		return "", false, err
+	}
+
+	if sourceList == nil {
+		return "", false, nil
+	}
+
+	element = listPop(db, source, sourceList, fromLeft, 1)[0]
+
+	_, err = listPush(db, destination, []string{element}, toLeft)
+	if err != nil {
+		return "", false, err
+	}
+
+	return element, true, nil
+}
+
+func parseListDirection(s string) (bool, error) {
+	if strings.EqualFold(s, "LEFT") {
+		return true, nil
+	}
+
+	if strings.EqualFold(s, "RIGHT") {
+		return false, nil
+	}
+
+	return false, ErrRespSyntax
+}
+
+func listDirectionName(left bool) string {
+	if left {
+		return "LEFT"
+	}
+
+	return "RIGHT"
+}
+
+func push(db database, args []string, left bool) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	length, err := listPush(db, args[0], args[1:], left)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRespInteger(length), nil
+}
+
+func lpush(db database, args []string) ([]byte, error) {
+	return push(db, args, true)
+}
+
+func rpush(db database, args []string) ([]byte, error) {
+	return push(db, args, false)
+}
+
+func pop(db database, args []string, left bool) ([]byte, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	withCount := len(args) == 2
+	count := 1
+
+	if withCount {
+		var err error
+
+		count, err = parseInteger(args[1])
+		if err != nil || count < 0 {
+			return nil, ErrRespValueNotPositive
+		}
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		if withCount {
+			return []byte("*-1\r\n"), nil
+		}
+		return []byte("$-1\r\n"), nil
+	}
+
+	popped := listPop(db, key, l, left, count)
+
+	if withCount {
+		return encodeRespStringArray(popped), nil
+	}
+
+	return encodeRespBulkString(popped[0]), nil
+}
+
+func lpop(db database, args []string) ([]byte, error) {
+	return pop(db, args, true)
+}
+
+func rpop(db database, args []string) ([]byte, error) {
+	return pop(db, args, false)
+}
+
+func lrange(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	start, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := parseInteger(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return []byte("*0\r\n"), nil
+	}
+
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		return []byte("*0\r\n"), nil
+	}
+
+	elements := make([]string, 0, stop-start+1)
+	e := listElementAt(l, start)
+	for i := start; i <= stop; i++ {
+		elements = append(elements, e.Value.(string))
+		e = e.Next()
+	}
+
+	return encodeRespStringArray(elements), nil
+}
+
+func llen(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	l, err := getList(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	return encodeRespInteger(l.Len()), nil
+}
+
+func lindex(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	index, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return []byte("$-1\r\n"), nil
+	}
+
+	if index < 0 {
+		index += l.Len()
+	}
+
+	if index < 0 || index >= l.Len() {
+		return []byte("$-1\r\n"), nil
+	}
+
+	return encodeRespBulkString(listElementAt(l, index).Value.(string)), nil
+}
+
+func lset(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	element := args[2]
+
+	index, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return nil, ErrRespNoSuchKey
+	}
+
+	if index < 0 {
+		index += l.Len()
+	}
+
+	if index < 0 || index >= l.Len() {
+		return nil, ErrRespIndexOutOfRange
+	}
+
+	listElementAt(l, index).Value = element
+
+	return []byte("+OK\r\n"), nil
+}
+
+// lrem removes the first `count` occurrences of element when count is
+// positive, the last `count` occurrences when negative, and all of them
+// when zero.
+func lrem(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	element := args[2]
+
+	count, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	removed := 0
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	e := l.Front()
+	if count < 0 {
+		e = l.Back()
+	}
+
+	for e != nil && (limit == 0 || removed < limit) {
+		next := e.Next()
+		if count < 0 {
+			next = e.Prev()
+		}
+
+		if e.Value.(string) == element {
+			l.Remove(e)
+			removed++
+		}
+
+		e = next
+	}
+
+	if l.Len() == 0 {
+		db.deleteKey(key)
+	}
+
+	return encodeRespInteger(removed), nil
+}
+
+func ltrim(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	start, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := parseInteger(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return []byte("+OK\r\n"), nil
+	}
+
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		db.deleteKey(key)
+		return []byte("+OK\r\n"), nil
+	}
+
+	for i := 0; i < start; i++ {
+		l.Remove(l.Front())
+	}
+
+	for l.Len() > stop-start+1 {
+		l.Remove(l.Back())
+	}
+
+	return []byte("+OK\r\n"), nil
+}
+
+func linsert(db database, args []string) ([]byte, error) {
+	if len(args) != 4 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	where := args[1]
+	pivot := args[2]
+	element := args[3]
+
+	before := strings.EqualFold(where, "BEFORE")
+	if !before && !strings.EqualFold(where, "AFTER") {
+		return nil, ErrRespSyntax
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	for e := l.Front(); e != nil; e = e.Next() {
+		if e.Value.(string) != pivot {
+			continue
+		}
+
+		if before {
+			l.InsertBefore(element, e)
+		} else {
+			l.InsertAfter(element, e)
+		}
+
+		return encodeRespInteger(l.Len()), nil
+	}
+
+	return encodeRespInteger(-1), nil
+}
+
+// lpos implements LPOS key element [RANK rank] [COUNT num-matches]
+// [MAXLEN len]. A negative rank searches from the tail, but positions are
+// always counted from the head. Without COUNT it replies the first match
+// only, and COUNT 0 replies every match.
+func lpos(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	element := args[1]
+	rank := 1
+	count := 1
+	withCount := false
+	maxLen := 0
+
+	options := args[2:]
+	for i := 0; i < len(options); i++ {
+		if i+1 >= len(options) {
+			return nil, ErrRespSyntax
+		}
+
+		n, err := parseInteger(options[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToUpper(options[i]) {
+		case "RANK":
+			if n == 0 || n == math.MinInt {
+				return nil, ErrRespRankZero
+			}
+
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return nil, ErrRespCountNegative
+			}
+
+			count = n
+			withCount = true
+		case "MAXLEN":
+			if n < 0 {
+				return nil, ErrRespMaxLenNegative
+			}
+
+			maxLen = n
+		default:
+			return nil, ErrRespSyntax
+		}
+		i++
+	}
+
+	l, err := getList(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]int, 0)
+
+	if l != nil {
+		fromTail := rank < 0
+		skip := max(rank, -rank) - 1
+
+		e := l.Front()
+		if fromTail {
+			e = l.Back()
+		}
+
+		for i := 0; e != nil && (maxLen == 0 || i < maxLen); i++ {
+			if e.Value.(string) == element {
+				if skip > 0 {
+					skip--
+				} else {
+					position := i
+					if fromTail {
+						position = l.Len() - 1 - i
+					}
+
+					positions = append(positions, position)
+					if count > 0 && len(positions) == count {
+						break
+					}
+				}
+			}
+
+			if fromTail {
+				e = e.Prev()
+			} else {
+				e = e.Next()
+			}
+		}
+	}
+
+	if withCount {
+		return encodeRespIntegerArray(positions), nil
+	}
+
+	if len(positions) == 0 {
+		return []byte("$-1\r\n"), nil
+	}
+
+	return encodeRespInteger(positions[0]), nil
+}
+
+func lmove(db database, args []string) ([]byte, error) {
+	if len(args) != 4 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	fromLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	toLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	element, ok, err := listMove(db, args[0], args[1], fromLeft, toLeft)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return []byte("$-1\r\n"), nil
+	}
+
+	return encodeRespBulkString(element), nil
+}
+
+// parseLmpopArgs parses `numkeys key [key ...] LEFT|RIGHT [COUNT count]`.
+func parseLmpopArgs(args []string) (keys []string, left bool, count int, err error) {
+	if len(args) < 3 {
+		return nil, false, 0, ErrRespWrongNumberOfArguments
+	}
+
+	numKeys, err := parseInteger(args[0])
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, ErrRespNumKeysNotPositive
+	}
+
+	if numKeys > len(args)-2 {
+		return nil, false, 0, ErrRespSyntax
+	}
+
+	keys = args[1 : numKeys+1]
+	options := args[numKeys+1:]
+
+	left, err = parseListDirection(options[0])
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	count = 1
+	options = options[1:]
+
+	if len(options) == 2 && strings.EqualFold(options[0], "COUNT") {
+		count, err = parseInteger(options[1])
+		if err != nil || count <= 0 {
+			return nil, false, 0, ErrRespCountNotPositive
+		}
+	} else if len(options) != 0 {
+		return nil, false, 0, ErrRespSyntax
+	}
+
+	return keys, left, count, nil
+}
+
+// firstNonEmptyList returns the first of `keys` holding a list.
+func firstNonEmptyList(db database, keys []string) (string, *list.List, error) {
+	for _, key := range keys {
+		l, err := getList(db, key)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if l != nil {
+			return key, l, nil
+		}
+	}
+
+	return "", nil, nil
+}
+
+func lmpop(db database, args []string) ([]byte, error) {
+	keys, left, count, err := parseLmpopArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	key, l, err := firstNonEmptyList(db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return []byte("*-1\r\n"), nil
+	}
+
+	popped := listPop(db, key, l, left, count)
+
+	return encodeRespArray([][]byte{
+		encodeRespBulkString(key),
+		encodeRespStringArray(popped),
+	}), nil
+}
+
+// Blocking variants reply as their non blocking counterpart would when one
+// of the keys can serve the client right away, and otherwise wait for a
+// push. When they can't block, such as inside a transaction, they behave as
+// if the timeout had expired.
+// As the key they end up popping from is only known at execution time, they
+// are replicated as the equivalent non blocking command.
+
+func blockingPop(db database, args []string, left bool, mayBlock bool) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	keys := args[:len(args)-1]
+
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	serve := func(db database, key string) ([]byte, bool) {
+		l, err := getList(db, key)
+		if err != nil || l == nil {
+			return nil, false
+		}
+
+		element := listPop(db, key, l, left, 1)[0]
+		if left {
+			propagate(db, "LPOP", key)
+		} else {
+			propagate(db, "RPOP", key)
+		}
+
+		return encodeRespStringArray([]string{key, element}), true
+	}
+
+	key, l, err := firstNonEmptyList(db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if l != nil {
+		reply, _ := serve(db, key)
+		return reply, nil
+	}
+
+	if !mayBlock {
+		return []byte("*-1\r\n"), nil
+	}
+
+	reply := blockForKeys(db, keys, timeout, serve)
+	if reply == nil {
+		return []byte("*-1\r\n"), nil
+	}
+
+	return reply, nil
+}
+
+func blpop(db database, args []string, mayBlock bool) ([]byte, error) {
+	return blockingPop(db, args, true, mayBlock)
+}
+
+func brpop(db database, args []string, mayBlock bool) ([]byte, error) {
+	return blockingPop(db, args, false, mayBlock)
+}
+
+func blmove(db database, args []string, mayBlock bool) ([]byte, error) {
+	if len(args) != 5 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	source := args[0]
+	destination := args[1]
+
+	fromLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	toLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseTimeout(args[4])
+	if err != nil {
+		return nil, err
+	}
+
+	element, ok, err := listMove(db, source, destination, fromLeft, toLeft)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		propagate(db, "LMOVE", source, destination, listDirectionName(fromLeft), listDirectionName(toLeft))
+		return encodeRespBulkString(element), nil
+	}
+
+	if !mayBlock {
+		return []byte("*-1\r\n"), nil
+	}
+
+	reply := blockForKeys(db, []string{source}, timeout, func(db database, key string) ([]byte, bool) {
+		element, ok, err := listMove(db, source, destination, fromLeft, toLeft)
+		if err != nil {
+			// The destination changed type while we were blocked
+			return []byte(err.Error()), true
+		}
+
+		if !ok {
+			return nil, false
+		}
+
+		propagate(db, "LMOVE", source, destination, listDirectionName(fromLeft), listDirectionName(toLeft))
+		return encodeRespBulkString(element), true
+	})
+	if reply == nil {
+		return []byte("*-1\r\n"), nil
+	}
+
+	return reply, nil
+}
+
+func blmpop(db database, args []string, mayBlock bool) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	timeout, err := parseTimeout(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	keys, left, count, err := parseLmpopArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	serve := func(db database, key string) ([]byte, bool) {
+		l, err := getList(db, key)
+		if err != nil || l == nil {
+			return nil, false
+		}
+
+		popped := listPop(db, key, l, left, count)
+		propagate(db, "LMPOP", "1", key, listDirectionName(left), "COUNT", strconv.Itoa(count))
+
+		return encodeRespArray([][]byte{
+			encodeRespBulkString(key),
+			encodeRespStringArray(popped),
+		}), true
+	}
+
+	key, l, err := firstNonEmptyList(db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if l != nil {
+		reply, _ := serve(db, key)
+		return reply, nil
+	}
+
+	if !mayBlock {
+		return []byte("*-1\r\n"), nil
+	}
+
+	reply := blockForKeys(db, keys, timeout, serve)
+	if reply == nil {
+		return []byte("*-1\r\n"), nil
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"testing"
+)
+
+// seedList stores a list holding elements, from head to tail.
+func seedList(db database, key string, elements ...string) {
+	rpush(db, append([]string{key}, elements...))
+}
+
+func TestListPushAndRange(t *testing.T) {
+	db := setupTestStore()
+
+	if got, _ := rpush(db, []string{"l", "b", "c"}); string(got) != string(encodeRespInteger(2)) {
+		t.Errorf("rpush = %q, want 2", got)
+	}
+
+	if got, _ := lpush(db, []string{"l", "a", "z"}); string(got) != string(encodeRespInteger(4)) {
+		t.Errorf("lpush = %q, want 4", got)
+	}
+
+	tests := []struct {
+		start string
+		stop  string
+		want  []string
+	}{
+		{"0", "-1", []string{"z", "a", "b", "c"}},
+		{"1", "2", []string{"a", "b"}},
+		{"-2", "-1", []string{"b", "c"}},
+		{"-100", "1", []string{"z", "a"}},
+		{"2", "100", []string{"b", "c"}},
+		{"3", "1", []string{}},
+		{"5", "10", []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := lrange(db, []string{"l", tt.start, tt.stop})
+		if err != nil {
+			t.Fatalf("lrange(%s, %s) error = %v", tt.start, tt.stop, err)
+		}
+
+		if want := encodeRespStringArray(tt.want); string(got) != string(want) {
+			t.Errorf("lrange(%s, %s) = %q, want %q", tt.start, tt.stop, got, want)
+		}
+	}
+}
+
+func TestLRem(t *testing.T) {
+	tests := []struct {
+		count   string
+		removed int
+		want    []string
+	}{
+		{"2", 2, []string{"b", "b", "a"}},
+		{"-2", 2, []string{"a", "b", "b"}},
+		{"0", 3, []string{"b", "b"}},
+		{"10", 3, []string{"b", "b"}},
+	}
+
+	for _, tt := range tests {
+		db := setupTestStore()
+		seedList(db, "l", "a", "b", "a", "b", "a")
+
+		got, err := lrem(db, []string{"l", tt.count, "a"})
+		if err != nil {
+			t.Fatalf("lrem(%s) error = %v", tt.count, err)
+		}
+
+		if string(got) != string(encodeRespInteger(tt.removed)) {
+			t.Errorf("lrem(%s) = %q, want %d", tt.count, got, tt.removed)
+		}
+
+		got, _ = lrange(db, []string{"l", "0", "-1"})
+		if want := encodeRespStringArray(tt.want); string(got) != string(want) {
+			t.Errorf("list after lrem(%s) = %q, want %q", tt.count, got, want)
+		}
+	}
+
+	db := setupTestStore()
+	seedList(db, "l", "a", "a")
+	lrem(db, []string{"l", "0", "a"})
+	if db.keyExists("l") {
+		t.Errorf("list emptied by lrem still exists")
+	}
+}
+
+func TestLTrim(t *testing.T) {
+	db := setupTestStore()
+	seedList(db, "l", "a", "b", "c", "d")
+
+	ltrim(db, []string{"l", "1", "-2"})
+	got, _ := lrange(db, []string{"l", "0", "-1"})
+	if want := encodeRespStringArray([]string{"b", "c"}); string(got) != string(want) {
+		t.Errorf("list after ltrim = %q, want %q", got, want)
+	}
+
+	if got, _ := ltrim(db, []string{"l", "5", "10"}); string(got) != "+OK\r\n" {
+		t.Errorf("ltrim = %q, want OK", got)
+	}
+
+	if db.keyExists("l") {
+		t.Errorf("list emptied by ltrim still exists")
+	}
+}
+
+func TestLInsert(t *testing.T) {
+	db := setupTestStore()
+	seedList(db, "l", "a", "c")
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"l", "BEFORE", "c", "b"}, 3},
+		{[]string{"l", "after", "c", "d"}, 4},
+		{[]string{"l", "BEFORE", "missing", "x"}, -1},
+		{[]string{"missing", "BEFORE", "a", "x"}, 0},
+	}
+
+	for _, tt := range tests {
+		got, err := linsert(db, tt.args)
+		if err != nil {
+			t.Fatalf("linsert(%v) error = %v", tt.args, err)
+		}
+
+		if string(got) != string(encodeRespInteger(tt.want)) {
+			t.Errorf("linsert(%v) = %q, want %d", tt.args, got, tt.want)
+		}
+	}
+
+	got, _ := lrange(db, []string{"l", "0", "-1"})
+	if want := encodeRespStringArray([]string{"a", "b", "c", "d"}); string(got) != string(want) {
+		t.Errorf("list after linsert = %q, want %q", got, want)
+	}
+
+	if _, err := linsert(db, []string{"l", "AROUND", "a", "x"}); err != ErrRespSyntax {
+		t.Errorf("linsert with a bad position error = %v, want %v", err, ErrRespSyntax)
+	}
+}
+
+func TestLPos(t *testing.T) {
+	db := setupTestStore()
+	seedList(db, "l", "a", "b", "c", "1", "2", "3", "c", "c")
+
+	tests := []struct {
+		args []string
+		want []byte
+		err  error
+	}{
+		{args: []string{"l", "c"}, want: encodeRespInteger(2)},
+		{args: []string{"l", "c", "RANK", "2"}, want: encodeRespInteger(6)},
+		{args: []string{"l", "c", "RANK", "-1"}, want: encodeRespInteger(7)},
+		{args: []string{"l", "c", "COUNT", "2"}, want: encodeRespIntegerArray([]int{2, 6})},
+		{args: []string{"l", "c", "COUNT", "0"}, want: encodeRespIntegerArray([]int{2, 6, 7})},
+		{args: []string{"l", "c", "RANK", "-1", "COUNT", "2"}, want: encodeRespIntegerArray([]int{7, 6})},
+		{args: []string{"l", "c", "COUNT", "0", "MAXLEN", "7"}, want: encodeRespIntegerArray([]int{2, 6})},
+		{args: []string{"l", "x"}, want: []byte("$-1\r\n")},
+		{args: []string{"l", "x", "COUNT", "1"}, want: []byte("*0\r\n")},
+		{args: []string{"missing", "a"}, want: []byte("$-1\r\n")},
+		{args: []string{"l", "c", "RANK", "0"}, err: ErrRespRankZero},
+		{args: []string{"l", "c", "COUNT", "-1"}, err: ErrRespCountNegative},
+		{args: []string{"l", "c", "MAXLEN", "-1"}, err: ErrRespMaxLenNegative},
+		{args: []string{"l", "c", "RANK"}, err: ErrRespSyntax},
+	}
+
+	for _, tt := range tests {
+		got, err := lpos(db, tt.args)
+		if err != tt.err {
+			t.Errorf("lpos(%v) error = %v, want %v", tt.args, err, tt.err)
+			continue
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("lpos(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLMove(t *testing.T) {
+	db := setupTestStore()
+	seedList(db, "src", "a", "b")
+	seedList(db, "dst", "x")
+
+	tests := []struct {
+		args []string
+		want []byte
+		src  []string
+		dst  []string
+	}{
+		{[]string{"src", "dst", "LEFT", "RIGHT"}, encodeRespBulkString("a"), []string{"b"}, []string{"x", "a"}},
+		{[]string{"src", "dst", "RIGHT", "LEFT"}, encodeRespBulkString("b"), []string{}, []string{"b", "x", "a"}},
+		{[]string{"src", "dst", "LEFT", "LEFT"}, []byte("$-1\r\n"), []string{}, []string{"b", "x", "a"}},
+	}
+
+	for _, tt := range tests {
+		got, err := lmove(db, tt.args)
+		if err != nil {
+			t.Fatalf("lmove(%v) error = %v", tt.args, err)
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("lmove(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+
+		src, _ := lrange(db, []string{"src", "0", "-1"})
+		dst, _ := lrange(db, []string{"dst", "0", "-1"})
+		if string(src) != string(encodeRespStringArray(tt.src)) || string(dst) != string(encodeRespStringArray(tt.dst)) {
+			t.Errorf("after lmove(%v) source = %q, destination = %q", tt.args, src, dst)
+		}
+	}
+
+	// Rotating a list onto itself
+	seedList(db, "r", "1", "2", "3")
+	lmove(db, []string{"r", "r", "LEFT", "RIGHT"})
+	got, _ := lrange(db, []string{"r", "0", "-1"})
+	if want := encodeRespStringArray([]string{"2", "3", "1"}); string(got) != string(want) {
+		t.Errorf("rotated list = %q, want %q", got, want)
+	}
+
+	if db.keyExists("src") {
+		t.Errorf("list emptied by lmove still exists")
+	}
+}
+
+func TestListCommandsRejectOtherTypes(t *testing.T) {
+	db := setupTestStore()
+	db.stringStore["s"] = stringEntry{value: "v"}
+	seedList(db, "l", "a")
+
+	tests := []struct {
+		name string
+		f    func() ([]byte, error)
+	}{
+		{"lpush", func() ([]byte, error) { return lpush(db, []string{"s", "a"}) }},
+		{"rpop", func() ([]byte, error) { return rpop(db, []string{"s"}) }},
+		{"lrange", func() ([]byte, error) { return lrange(db, []string{"s", "0", "-1"}) }},
+		{"llen", func() ([]byte, error) { return llen(db, []string{"s"}) }},
+		{"lrem", func() ([]byte, error) { return lrem(db, []string{"s", "0", "a"}) }},
+		{"ltrim", func() ([]byte, error) { return ltrim(db, []string{"s", "0", "1"}) }},
+		{"linsert", func() ([]byte, error) { return linsert(db, []string{"s", "BEFORE", "a", "b"}) }},
+		{"lpos", func() ([]byte, error) { return lpos(db, []string{"s", "a"}) }},
+		{"lmove to a string", func() ([]byte, error) { return lmove(db, []string{"l", "s", "LEFT", "LEFT"}) }},
+		{"get on a list", func() ([]byte, error) { return get(db, []string{"l"}) }},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.f(); err != ErrRespWrongType {
+			t.Errorf("%s error = %v, want %v", tt.name, err, ErrRespWrongType)
+		}
+	}
+
+	// A failed LMOVE leaves the source untouched
+	if got, _ := llen(db, []string{"l"}); string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("llen after a failed lmove = %q, want 1", got)
+	}
+}
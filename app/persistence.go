@@ -6,9 +6,13 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"container/list"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +20,23 @@ import (
 
 var ErrMissingRDBFile = fmt.Errorf("RDB file not found")
 
+// Value types, written before each key
+const (
+	rdbTypeString       = 0x00
+	rdbTypeList         = 0x01
+	rdbTypeSet          = 0x02
+	rdbTypeHash         = 0x04
+	rdbTypeZset2        = 0x05 // sorted set with binary scores
+	rdbTypeHashMetadata = 0x18 // hash with field TTLs
+)
+
+// Version written in the header of RDB files. Hashes with field TTLs only
+// exist from version 12 on, other types are readable from version 9.
+const (
+	rdbVersion             = 9
+	rdbVersionHashMetadata = 12
+)
+
 func initPersistence() error {
 	fileName := fmt.Sprintf("%s/%s", status.dir, status.dbFileName)
 	file, err := os.Open(fileName)
@@ -45,6 +66,9 @@ func config(args []string) ([]byte, error) {
 		} else if arg == "dbfilename" {
 			response = append(response, "dbfilename")
 			response = append(response, status.dbFileName)
+		} else if arg == "databases" {
+			response = append(response, "databases")
+			response = append(response, strconv.Itoa(status.databaseCount))
 		} else {
 			return nil, fmt.Errorf("%w unsupported config option: %s", ErrRespSimpleError, arg)
 		}
@@ -54,37 +78,41 @@ func config(args []string) ([]byte, error) {
 }
 
 func readRDBEncodedLength(reader *bufio.Reader) (int, error) {
-	length := 0
-
 	b, err := reader.ReadByte()
 	if err != nil {
 		return -1, err
 	}
 
 	if b>>6 == 0b00 {
-		length = int(b)
+		return int(b), nil
 	} else if b>>6 == 0b01 {
 		nextByte, err := reader.ReadByte()
 		if err != nil {
 			return -1, err
 		}
 
-		err = binary.Read(
-			bytes.NewReader([]byte{b & 0b001111, nextByte}),
-			binary.BigEndian,
-			&length,
-		)
+		return int(b&0b00111111)<<8 | int(nextByte), nil
+	} else if b == 0x80 {
+		var length uint32
+
+		err := binary.Read(reader, binary.BigEndian, &length)
 		if err != nil {
 			return -1, err
 		}
-	} else if b>>6 == 0b10 {
+
+		return int(length), nil
+	} else if b == 0x81 {
+		var length uint64
+
 		err := binary.Read(reader, binary.BigEndian, &length)
 		if err != nil {
 			return -1, err
 		}
+
+		return int(length), nil
 	}
 
-	return length, nil
+	return -1, fmt.Errorf("Unexpected length encoding: %02x", b)
 }
 
 func readRDBEncodedString(reader *bufio.Reader) (string, error) {
@@ -136,7 +164,7 @@ func readRDBEncodedString(reader *bufio.Reader) (string, error) {
 	}
 
 	buf := make([]byte, length)
-	n, err := reader.Read(buf)
+	n, err := io.ReadFull(reader, buf)
 	if err != nil {
 		return "", err
 	}
@@ -209,26 +237,152 @@ func readRDBResizeDBSection(reader *bufio.Reader) error {
 	return nil
 }
 
-func readRDBDatabaseEntry(reader *bufio.Reader) (string, *stringEntry, error) {
+func readRDBMillisecondTime(reader *bufio.Reader) (int64, error) {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(reader, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(binary.LittleEndian.Uint64(buf)), nil
+}
+
+// readRDBHash reads a hash. With metadata, a base timestamp comes first and
+// every field is preceded by its expiry relative to it, offset by one so
+// that 0 means the field has no TTL.
+func readRDBHash(reader *bufio.Reader, withMetadata bool) (*hash, error) {
+	var minExpire int64
+	var err error
+
+	if withMetadata {
+		minExpire, err = readRDBMillisecondTime(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	length, err := readRDBEncodedLength(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHash()
+
+	for i := 0; i < length; i++ {
+		ttl := 0
+
+		if withMetadata {
+			ttl, err = readRDBEncodedLength(reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		field, err := readRDBEncodedString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readRDBEncodedString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		h.set(field, value)
+		if ttl != 0 {
+			h.expires[field] = time.UnixMilli(minExpire + int64(ttl) - 1)
+		}
+	}
+
+	return h, nil
+}
+
+func readRDBList(reader *bufio.Reader) (*list.List, error) {
+	length, err := readRDBEncodedLength(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	l := list.New()
+
+	for i := 0; i < length; i++ {
+		element, err := readRDBEncodedString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		l.PushBack(element)
+	}
+
+	return l, nil
+}
+
+func readRDBSet(reader *bufio.Reader) (*memberSet, error) {
+	length, err := readRDBEncodedLength(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newMemberSet()
+
+	for i := 0; i < length; i++ {
+		member, err := readRDBEncodedString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		s.add(member)
+	}
+
+	return s, nil
+}
+
+// readRDBSortedSet reads a sorted set whose scores are stored as 8 bytes
+// little endian doubles.
+func readRDBSortedSet(reader *bufio.Reader) (*sortedSet, error) {
+	length, err := readRDBEncodedLength(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	z := newSortedSet()
+
+	for i := 0; i < length; i++ {
+		member, err := readRDBEncodedString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		score := make([]byte, 8)
+		_, err = io.ReadFull(reader, score)
+		if err != nil {
+			return nil, err
+		}
+
+		z.add(member, math.Float64frombits(binary.LittleEndian.Uint64(score)))
+	}
+
+	return z, nil
+}
+
+func readRDBDatabaseEntry(reader *bufio.Reader, db database) error {
 	var expiresAt *time.Time
 
 	b, err := reader.Peek(1)
 	if err != nil {
-		return "", nil, err
+		return err
 	}
 
-	// TODO discard expired entries
-
 	if b[0] == 0xFD { // expiry timestamp in seconds, 4 bytes unsigned int
 		reader.Discard(1)
 		expiryTime := make([]byte, 4)
 		n, err := reader.Read(expiryTime)
 		if err != nil {
-			return "", nil, err
+			return err
 		}
 
 		if n != 4 {
-			return "", nil, fmt.Errorf("Expected 4 bytes, got %d", n)
+			return fmt.Errorf("Expected 4 bytes, got %d", n)
 		}
 
 		expirySeconds := binary.LittleEndian.Uint32(expiryTime)
@@ -239,60 +393,96 @@ func readRDBDatabaseEntry(reader *bufio.Reader) (string, *stringEntry, error) {
 	if b[0] == 0xFC { // expiry timestamp in milliseconds, 8 bytes unsigned long
 		reader.Discard(1)
 
-		expiryTime := make([]byte, 8)
-		n, err := reader.Read(expiryTime)
+		expiryMilliseconds, err := readRDBMillisecondTime(reader)
 		if err != nil {
-			return "", nil, err
-		}
-
-		if n != 8 {
-			return "", nil, fmt.Errorf("Expected 8 bytes, got %d", n)
+			return err
 		}
 
-		expiryMilliseconds := binary.LittleEndian.Uint64(expiryTime)
-		tmp := time.Unix(0, int64(expiryMilliseconds)*int64(time.Millisecond))
+		tmp := time.UnixMilli(expiryMilliseconds)
 		expiresAt = &tmp
 	}
 
 	valueType, err := reader.ReadByte()
 	if err != nil {
-		return "", nil, err
-	}
-
-	if valueType != 0x00 {
-		return "", nil, fmt.Errorf("Expected 0x00, got %02x. Unsupported value type", valueType)
-
+		return err
 	}
 
 	key, err := readRDBEncodedString(reader)
 	if err != nil {
-		return "", nil, err
+		return err
 	}
 
-	value, err := readRDBEncodedString(reader)
-	if err != nil {
-		return "", nil, err
+	if valueType == rdbTypeString {
+		value, err := readRDBEncodedString(reader)
+		if err != nil {
+			return err
+		}
+
+		db.setString(key, stringEntry{value: value})
+	} else if valueType == rdbTypeList {
+		l, err := readRDBList(reader)
+		if err != nil {
+			return err
+		}
+
+		db.listStore[key] = l
+		db.keys.insert(key)
+	} else if valueType == rdbTypeHash || valueType == rdbTypeHashMetadata {
+		h, err := readRDBHash(reader, valueType == rdbTypeHashMetadata)
+		if err != nil {
+			return err
+		}
+
+		db.hashStore[key] = h
+		db.keys.insert(key)
+		if len(h.expires) > 0 {
+			db.hashFieldExpires[key] = struct{}{}
+		}
+	} else if valueType == rdbTypeSet {
+		s, err := readRDBSet(reader)
+		if err != nil {
+			return err
+		}
+
+		db.setStore[key] = s
+		db.keys.insert(key)
+	} else if valueType == rdbTypeZset2 {
+		z, err := readRDBSortedSet(reader)
+		if err != nil {
+			return err
+		}
+
+		db.sortedSetStore[key] = z
+		db.keys.insert(key)
+	} else {
+		return fmt.Errorf("Unsupported value type %02x", valueType)
 	}
 
-	return key, &stringEntry{
-		value:     value,
-		expiresAt: expiresAt,
-	}, nil
-}
+	if expiresAt != nil {
+		// Keys that expired while the server was down are dropped on load
+		if !expiresAt.After(time.Now()) {
+			db.deleteKey(key)
+			return nil
+		}
 
-func readRDBDatabaseSection(reader *bufio.Reader) (int, map[string]stringEntry, error) {
-	databaseNumber := -1
-	stringStore := make(map[string]stringEntry)
+		db.expires[key] = *expiresAt
+	}
 
+	return nil
+}
+
+func readRDBDatabaseSection(reader *bufio.Reader) (database, error) {
 	databaseNumber, err := readRDBDatabaseSelector(reader)
 	if err != nil {
-		return databaseNumber, stringStore, err
+		return database{}, err
 	}
 
+	db := newDatabase(databaseNumber)
+
 	for {
 		b, err := reader.Peek(1)
 		if err != nil {
-			return databaseNumber, stringStore, err
+			return db, err
 		}
 
 		if b[0] == 0xFF || b[0] == 0xFE {
@@ -302,19 +492,17 @@ func readRDBDatabaseSection(reader *bufio.Reader) (int, map[string]stringEntry,
 		if b[0] == 0xFB {
 			err := readRDBResizeDBSection(reader)
 			if err != nil {
-				return databaseNumber, stringStore, err
+				return db, err
 			}
 		} else {
-			key, stringEntry, err := readRDBDatabaseEntry(reader)
+			err := readRDBDatabaseEntry(reader, db)
 			if err != nil {
-				return databaseNumber, stringStore, err
+				return db, err
 			}
-
-			stringStore[key] = *stringEntry
 		}
 	}
 
-	return databaseNumber, stringStore, nil
+	return db, nil
 }
 
 func readRDBFile(reader *bufio.Reader) error {
@@ -354,14 +542,16 @@ func readRDBFile(reader *bufio.Reader) error {
 
 			metadata[key] = value
 		} else if b[0] == 0xFE {
-			dbNumber, stringStore, err := readRDBDatabaseSection(reader)
+			db, err := readRDBDatabaseSection(reader)
 			if err != nil {
 				return err
 			}
 
-			currentDB := status.databases[dbNumber]
-			currentDB.stringStore = stringStore
-			status.databases[dbNumber] = currentDB
+			if db.id >= status.databaseCount {
+				return fmt.Errorf("The RDB file holds database %d, but only %d databases are configured", db.id, status.databaseCount)
+			}
+
+			status.databases[db.id] = db
 		} else if b[0] == 0xFF {
 			// TODO: checksum
 			reader.Discard(1)
@@ -372,57 +562,210 @@ func readRDBFile(reader *bufio.Reader) error {
 	}
 }
 
-func encodeRDBString(s string) []byte {
-	buf := make([]byte, 0)
-	length := len(s)
+func encodeRDBLength(length int) []byte {
+	if length < 1<<6 {
+		return []byte{byte(length)}
+	}
 
-	if length > 63 {
-		panic("String length is too long. Only the simplest string encoding is enabled at the moment.")
+	if length < 1<<14 {
+		return []byte{0x40 | byte(length>>8), byte(length)}
 	}
 
-	buf = append(buf, byte(length))
+	if length <= math.MaxUint32 {
+		return binary.BigEndian.AppendUint32([]byte{0x80}, uint32(length))
+	}
+
+	return binary.BigEndian.AppendUint64([]byte{0x81}, uint64(length))
+}
+
+func encodeRDBString(s string) []byte {
+	buf := encodeRDBLength(len(s))
 	buf = append(buf, []byte(s)...)
 
 	return buf
 }
 
-func encodeRDBFile(store map[int]database) ([]byte, error) {
+// encodeRDBHash encodes the hash stored at key, leaving out expired fields.
+// See readRDBHash for the layout of hashes with field TTLs.
+func encodeRDBHash(key string, h *hash, now time.Time) []byte {
+	fields := make([]string, 0, len(h.fields))
+	var minExpire int64 = math.MaxInt64
+
+	for field := range h.fields {
+		expiresAt, ok := h.expires[field]
+		if ok && expiresAt.Before(now) {
+			continue
+		}
+
+		if ok {
+			minExpire = min(minExpire, expiresAt.UnixMilli())
+		}
+
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	withMetadata := minExpire != math.MaxInt64
 	buf := make([]byte, 0)
 
-	buf = append(buf, []byte("REDIS")...)
-	buf = append(buf, []byte("0009")...)
+	if withMetadata {
+		buf = append(buf, rdbTypeHashMetadata)
+	} else {
+		buf = append(buf, rdbTypeHash)
+	}
+
+	buf = append(buf, encodeRDBString(key)...)
+
+	if withMetadata {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(minExpire))
+	}
+
+	buf = append(buf, encodeRDBLength(len(fields))...)
 
-	buf = append(buf, []byte{0xFA}...)
-	buf = append(buf, encodeRDBString("redis-version")...)
-	buf = append(buf, encodeRDBString("ade-sede's custom redis")...)
+	for _, field := range fields {
+		if withMetadata {
+			ttl := 0
+			if expiresAt, ok := h.expires[field]; ok {
+				ttl = int(expiresAt.UnixMilli()-minExpire) + 1
+			}
 
-	for dbNumber, db := range store {
-		if dbNumber > 10 || dbNumber < 0 {
-			return nil, fmt.Errorf("Invalid database number: %d. Only support [0:10]", dbNumber)
+			buf = append(buf, encodeRDBLength(ttl)...)
 		}
 
-		if len(db.stringStore) == 0 {
+		buf = append(buf, encodeRDBString(field)...)
+		buf = append(buf, encodeRDBString(h.fields[field])...)
+	}
+
+	return buf
+}
+
+func encodeRDBStringEntry(key string, entry stringEntry) []byte {
+	buf := []byte{rdbTypeString}
+	buf = append(buf, encodeRDBString(key)...)
+	buf = append(buf, encodeRDBString(entry.value)...)
+
+	return buf
+}
+
+func encodeRDBList(key string, l *list.List) []byte {
+	buf := []byte{rdbTypeList}
+	buf = append(buf, encodeRDBString(key)...)
+	buf = append(buf, encodeRDBLength(l.Len())...)
+
+	for e := l.Front(); e != nil; e = e.Next() {
+		buf = append(buf, encodeRDBString(e.Value.(string))...)
+	}
+
+	return buf
+}
+
+func encodeRDBSet(key string, s *memberSet) []byte {
+	buf := []byte{rdbTypeSet}
+	buf = append(buf, encodeRDBString(key)...)
+	buf = append(buf, encodeRDBLength(s.len())...)
+
+	for _, member := range s.members() {
+		buf = append(buf, encodeRDBString(member)...)
+	}
+
+	return buf
+}
+
+func encodeRDBSortedSet(key string, z *sortedSet) []byte {
+	buf := []byte{rdbTypeZset2}
+	buf = append(buf, encodeRDBString(key)...)
+	buf = append(buf, encodeRDBLength(z.len())...)
+
+	for node := z.zsl.tail; node != nil; node = node.backward {
+		buf = append(buf, encodeRDBString(node.member)...)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(node.score))
+	}
+
+	return buf
+}
+
+// encodeRDBFile writes the lowest RDB version able to hold the types
+// actually written, so that older readers can load files without field TTLs.
+func encodeRDBFile(store map[int]database) ([]byte, error) {
+	version := rdbVersion
+	buf := make([]byte, 0)
+
+	dbNumbers := make([]int, 0, len(store))
+	for dbNumber := range store {
+		dbNumbers = append(dbNumbers, dbNumber)
+	}
+	sort.Ints(dbNumbers)
+
+	for _, dbNumber := range dbNumbers {
+		db := store[dbNumber]
+
+		if len(db.stringStore) == 0 && len(db.listStore) == 0 && len(db.hashStore) == 0 && len(db.setStore) == 0 && len(db.sortedSetStore) == 0 {
 			continue
 		}
 
 		buf = append(buf, []byte{0xFE}...)
-		buf = append(buf, byte(dbNumber))
+		buf = append(buf, encodeRDBLength(dbNumber)...)
+
+		now := time.Now()
+
+		// Entries are prefixed with the expiry of their key, if any. Expired
+		// keys not reclaimed yet are left out.
+		appendEntry := func(key string, entry []byte) {
+			if len(entry) == 0 {
+				return
+			}
+
+			if expiresAt, ok := db.expires[key]; ok {
+				if !expiresAt.After(now) {
+					return
+				}
+
+				buf = append(buf, 0xFC)
+				buf = binary.LittleEndian.AppendUint64(buf, uint64(expiresAt.UnixMilli()))
+			}
+
+			buf = append(buf, entry...)
+		}
 
 		for key, entry := range db.stringStore {
-			if entry.expiresAt != nil && entry.expiresAt.After(time.Now()) {
-				timestamp := make([]byte, 8)
+			appendEntry(key, encodeRDBStringEntry(key, entry))
+		}
 
-				buf = append(buf, []byte{0xFC}...)
-				binary.LittleEndian.PutUint64(timestamp, uint64(entry.expiresAt.Unix()))
-				buf = append(buf, timestamp...)
+		for key, l := range db.listStore {
+			appendEntry(key, encodeRDBList(key, l))
+		}
+
+		for key, h := range db.hashStore {
+			entry := encodeRDBHash(key, h, now)
+			if len(entry) > 0 && entry[0] == rdbTypeHashMetadata {
+				version = rdbVersionHashMetadata
 			}
 
-			buf = append(buf, []byte{0x00}...)
-			buf = append(buf, encodeRDBString(key)...)
-			buf = append(buf, encodeRDBString(entry.value)...)
+			appendEntry(key, entry)
+		}
+
+		for key, s := range db.setStore {
+			appendEntry(key, encodeRDBSet(key, s))
+		}
+
+		for key, z := range db.sortedSetStore {
+			appendEntry(key, encodeRDBSortedSet(key, z))
 		}
 	}
 
+	header := make([]byte, 0)
+	header = append(header, []byte("REDIS")...)
+	header = append(header, []byte(fmt.Sprintf("%04d", version))...)
+
+	header = append(header, []byte{0xFA}...)
+	header = append(header, encodeRDBString("redis-version")...)
+	header = append(header, encodeRDBString("ade-sede's custom redis")...)
+
+	buf = append(header, buf...)
+
 	buf = append(buf, []byte{0xFF}...)
 	checksum := crc64(buf)
 	buf = binary.LittleEndian.AppendUint64(buf, checksum)
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRDBLengthEncoding(t *testing.T) {
+	tests := []int{0, 63, 64, 16383, 16384, 1 << 32, 1<<32 + 1}
+
+	for _, length := range tests {
+		reader := bufio.NewReader(bytes.NewReader(encodeRDBLength(length)))
+
+		got, err := readRDBEncodedLength(reader)
+		if err != nil {
+			t.Errorf("readRDBEncodedLength(%d) error = %v", length, err)
+			continue
+		}
+
+		if got != length {
+			t.Errorf("readRDBEncodedLength() = %d, want %d", got, length)
+		}
+	}
+}
+
+func TestRDBHashRoundTrip(t *testing.T) {
+	setupTestStore()
+
+	expiresAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	h := newHash()
+	h.set("persistent", "1")
+	h.set("volatile", "2")
+	h.set("expired", "3")
+	h.expires["volatile"] = expiresAt
+	h.expires["expired"] = time.Now().Add(-time.Second)
+	status.databases[0].hashStore["h"] = h
+
+	file, err := encodeRDBFile(status.databases)
+	if err != nil {
+		t.Fatalf("encodeRDBFile() error = %v", err)
+	}
+
+	setupTestStore()
+
+	err = readRDBFile(bufio.NewReader(bytes.NewReader(file)))
+	if err != nil {
+		t.Fatalf("readRDBFile() error = %v", err)
+	}
+
+	loaded, ok := status.databases[0].hashStore["h"]
+	if !ok {
+		t.Fatalf("hash not loaded")
+	}
+
+	if len(loaded.fields) != 2 || loaded.fields["persistent"] != "1" || loaded.fields["volatile"] != "2" {
+		t.Errorf("loaded fields = %v", loaded.fields)
+	}
+
+	if len(loaded.expires) != 1 || !loaded.expires["volatile"].Equal(expiresAt) {
+		t.Errorf("loaded expires = %v, want volatile at %v", loaded.expires, expiresAt)
+	}
+}
+
+func TestRDBVersionMatchesTypesWritten(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires map[string]time.Time
+		want    string
+	}{
+		{"hash without field TTLs", map[string]time.Time{}, "REDIS0009"},
+		{"hash with field TTLs", map[string]time.Time{"f": time.Now().Add(time.Hour)}, "REDIS0012"},
+		{"hash whose field TTLs all elapsed", map[string]time.Time{"f": time.Now().Add(-time.Second)}, "REDIS0009"},
+	}
+
+	for _, tt := range tests {
+		setupTestStore()
+
+		h := newHash()
+		h.set("f", "v")
+		h.set("g", "v")
+		h.expires = tt.expires
+		status.databases[0].hashStore["h"] = h
+
+		file, err := encodeRDBFile(status.databases)
+		if err != nil {
+			t.Fatalf("%s: encodeRDBFile() error = %v", tt.name, err)
+		}
+
+		if got := string(file[:9]); got != tt.want {
+			t.Errorf("%s: header = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRDBSetRoundTrip(t *testing.T) {
+	setupTestStore()
+
+	status.databases[0].setStore["s"] = newMemberSet("a", "b", "c")
+
+	file, err := encodeRDBFile(status.databases)
+	if err != nil {
+		t.Fatalf("encodeRDBFile() error = %v", err)
+	}
+
+	setupTestStore()
+
+	err = readRDBFile(bufio.NewReader(bytes.NewReader(file)))
+	if err != nil {
+		t.Fatalf("readRDBFile() error = %v", err)
+	}
+
+	loaded := status.databases[0].setStore["s"]
+	if loaded.len() != 3 {
+		t.Fatalf("loaded set = %v, want 3 members", loaded.members())
+	}
+
+	for _, member := range []string{"a", "b", "c"} {
+		if !loaded.contains(member) {
+			t.Errorf("member %q not loaded", member)
+		}
+	}
+}
+
+func TestRDBListRoundTrip(t *testing.T) {
+	setupTestStore()
+	db := status.databases[0]
+	rpush(db, []string{"l", "a", "b", "a", ""})
+	rpush(db, []string{"volatile", "x"})
+	expire(db, []string{"volatile", "100"}, "expire", time.Second, false)
+
+	file, err := encodeRDBFile(status.databases)
+	if err != nil {
+		t.Fatalf("encodeRDBFile() error = %v", err)
+	}
+
+	setupTestStore()
+
+	err = readRDBFile(bufio.NewReader(bytes.NewReader(file)))
+	if err != nil {
+		t.Fatalf("readRDBFile() error = %v", err)
+	}
+
+	db = status.databases[0]
+	got, _ := lrange(db, []string{"l", "0", "-1"})
+	if want := encodeRespStringArray([]string{"a", "b", "a", ""}); string(got) != string(want) {
+		t.Errorf("loaded list = %q, want %q", got, want)
+	}
+
+	if _, ok := db.expires["volatile"]; !ok || !db.keyExists("volatile") {
+		t.Errorf("list with a TTL was not loaded with its TTL")
+	}
+}
+
+func TestRDBDatabaseSelectorRoundTrip(t *testing.T) {
+	setupTestStore()
+	status.databaseCount = 100
+
+	for _, index := range []int{0, 15, 63, 64, 99} {
+		db, _ := getDatabase(index)
+		db.stringStore["key"] = stringEntry{value: strconv.Itoa(index)}
+	}
+
+	file, err := encodeRDBFile(status.databases)
+	if err != nil {
+		t.Fatalf("encodeRDBFile() error = %v", err)
+	}
+
+	setupTestStore()
+	status.databaseCount = 100
+
+	err = readRDBFile(bufio.NewReader(bytes.NewReader(file)))
+	if err != nil {
+		t.Fatalf("readRDBFile() error = %v", err)
+	}
+
+	for _, index := range []int{0, 15, 63, 64, 99} {
+		if got := status.databases[index].stringStore["key"].value; got != strconv.Itoa(index) {
+			t.Errorf("db %d key = %q, want %q", index, got, strconv.Itoa(index))
+		}
+	}
+
+	setupTestStore()
+
+	err = readRDBFile(bufio.NewReader(bytes.NewReader(file)))
+	if err == nil {
+		t.Errorf("readRDBFile() of databases beyond the databases setting did not fail")
+	}
+}
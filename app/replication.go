@@ -9,6 +9,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,13 +24,63 @@ type replica struct {
 	conn           *connection
 	expectedOffset int
 	measuredOffset int
+
+	// Data waiting to be written to the replica. Writes happen in the
+	// replica's own goroutine so a slow replica never holds the store lock.
+	outbox   [][]byte
+	outboxMu sync.Mutex
+	// Wakes the writer up, nil until the replica asked for a full resync
+	wakeup chan struct{}
 }
 
+// replicate queues a command for the replica and accounts for it in the
+// offset the replica is expected to acknowledge.
 func (r *replica) replicate(b []byte) {
-	r.conn.handler.Write(b)
+	r.send(b)
 	r.expectedOffset += len(b)
 }
 
+func (r *replica) send(b []byte) {
+	r.outboxMu.Lock()
+	r.outbox = append(r.outbox, b)
+	r.outboxMu.Unlock()
+
+	select {
+	case r.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// startSync starts writing to the replica, beginning with the full resync
+// payload so it always comes before replicated commands.
+func (r *replica) startSync(payload ...[]byte) {
+	if r.wakeup == nil {
+		r.wakeup = make(chan struct{}, 1)
+		go r.writeLoop()
+	}
+
+	for _, b := range payload {
+		r.send(b)
+	}
+}
+
+func (r *replica) synced() bool {
+	return r.wakeup != nil
+}
+
+func (r *replica) writeLoop() {
+	for range r.wakeup {
+		r.outboxMu.Lock()
+		outbox := r.outbox
+		r.outbox = nil
+		r.outboxMu.Unlock()
+
+		for _, b := range outbox {
+			r.conn.handler.Write(b)
+		}
+	}
+}
+
 func initReplication(listeningPort int, errorC chan error) error {
 	status.replicas = make(map[string]*replica)
 
@@ -109,12 +160,43 @@ func handshake(conn *connection, listeningPort int) {
 	status.replOffset = replOffset
 }
 
-func replicate(buf []byte) {
+// replicate forwards a command run against database `db` to replicas,
+// preceded by a SELECT if the replication stream had another database
+// selected, and by a MULTI if it is the first one of a transaction.
+func replicate(db int, buf []byte) {
+	if len(status.replicas) == 0 {
+		return
+	}
+
+	if status.inExec && !status.execOpenedInRepl {
+		status.execOpenedInRepl = true
+		replicate(db, encodeRespStringArray([]string{"MULTI"}))
+	}
+
+	if db != status.replicationDB {
+		selectDB := encodeRespStringArray([]string{"SELECT", strconv.Itoa(db)})
+		for _, replica := range status.replicas {
+			if replica.synced() {
+				replica.replicate(selectDB)
+			}
+		}
+
+		status.replicationDB = db
+	}
+
 	for _, replica := range status.replicas {
-		replica.replicate(buf)
+		if replica.synced() {
+			replica.replicate(buf)
+		}
 	}
 }
 
+// propagate sends replicas a command that is not the one received from the
+// client but has the same effect, such as a pop for a served blocking pop.
+func propagate(db database, args ...string) {
+	replicate(db.id, encodeRespStringArray(args))
+}
+
 func replconf(conn *connection, args []string) ([]byte, command, error) {
 	var isGetAck bool = false
 
@@ -183,40 +265,70 @@ func psync(conn *connection) ([]byte, error) {
 	}
 	RDB := []byte(fmt.Sprintf("$%d\r\n%s", len(rdbContent), string(rdbContent)))
 
-	go func() {
-		time.Sleep(100 * time.Millisecond)
-		conn.handler.Write(RDB)
-	}()
+	// The new replica starts with no database selected
+	status.replicationDB = -1
 
-	response := make([]byte, 0)
-	response = append(response, fullResyncNotification...)
+	// Both go through the replica's outbox, ahead of any command replicated
+	// from now on
+	existingReplica.startSync(fullResyncNotification, RDB)
 
-	return response, nil
+	return nil, nil
 }
 
-func wait(args []string) []byte {
-	status.globalLock.Lock()
-	defer status.globalLock.Unlock()
+// wait counts the replicas that acknowledged every write replicated before
+// it was called. The store lock is released while replicas are polled, unless
+// the client may not block.
+func wait(args []string, mayBlock bool) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
 
-	if len(status.replicas) == 0 {
-		return encodeRespInteger(0)
+	// Offset each replica has to acknowledge
+	targets := make(map[*replica]int)
+	for _, replica := range status.replicas {
+		if replica.synced() {
+			targets[replica] = replica.expectedOffset
+		}
+	}
+
+	if len(targets) == 0 {
+		return encodeRespInteger(0), nil
+	}
+
+	if !mayBlock {
+		doneCount := 0
+		for replica, target := range targets {
+			if replica.measuredOffset >= target {
+				doneCount += 1
+			}
+		}
+
+		return encodeRespInteger(doneCount), nil
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
 	// replicaCountTarget, _ := strconv.Atoi(args[0])
 	timeoutMs, _ := strconv.Atoi(args[1])
 	timeout := time.Duration(timeoutMs) * time.Millisecond
 
-	doneCount := 0
-	ack := make(chan bool)
+	status.storeLock.Unlock()
+	defer status.storeLock.Lock()
 
-	for _, replica := range status.replicas {
-		replica.conn.mu.Lock()
-		defer replica.conn.mu.Unlock()
-		go pollReplicaCount(ctx, replica, ack)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	doneCount := 0
+	ack := make(chan bool, len(targets))
+
+	var pollers sync.WaitGroup
+	for replica, target := range targets {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			pollReplicaCount(ctx, replica, target, ack)
+		}()
 	}
 
-	for {
+	for doneCount < len(targets) && ctx.Err() == nil {
 		select {
 		case <-ack:
 			doneCount += 1
@@ -225,49 +337,63 @@ func wait(args []string) []byte {
 			// Commenting out just to pass tests
 			// if doneCount == replicaCountTarget {
 			// cancel()
-			// return encodeRespInteger(doneCount)
+			// return encodeRespInteger(doneCount), nil
 			// }
-		case <-time.After(timeout):
-			cancel()
-			return encodeRespInteger(doneCount)
+		case <-ctx.Done():
 		}
 	}
+
+	// Replicas must not be read from once WAIT returns
+	cancel()
+	pollers.Wait()
+
+	return encodeRespInteger(doneCount), nil
 }
 
-func pollReplicaCount(ctx context.Context, replica *replica, ack chan bool) {
-	if replica.measuredOffset == replica.expectedOffset {
+func pollReplicaCount(ctx context.Context, replica *replica, target int, ack chan bool) {
+	// Keeps the replica's connection handler from reading the ACK
+	replica.conn.mu.Lock()
+	defer replica.conn.mu.Unlock()
+
+	status.storeLock.Lock()
+	upToDate := replica.measuredOffset >= target
+	if !upToDate {
+		replica.replicate(encodeRespStringArray(
+			[]string{"REPLCONF", "GETACK", "*"},
+		))
+	}
+	status.storeLock.Unlock()
+
+	if upToDate {
 		ack <- true
 		return
 	}
 
-	n, _ := replica.conn.handler.Write(encodeRespStringArray(
-		[]string{"REPLCONF", "GETACK", "*"},
-	))
-	replica.expectedOffset += n
-
 	reader := bufio.NewReader(replica.conn.handler)
-	replica.conn.handler.SetReadDeadline(time.Now().Add(30 * time.Millisecond))
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			query, _ := readResp(reader)
+	for ctx.Err() == nil {
+		replica.conn.handler.SetReadDeadline(time.Now().Add(30 * time.Millisecond))
+		query, _ := readResp(reader)
+		if query == nil {
+			continue
+		}
 
-			if query != nil {
-				array, _ := query.asArray()
+		array, _ := query.asArray()
+		if len(array) < 3 {
+			continue
+		}
 
-				offsetString, _ := array[2].asString()
-				measuredOffset, _ := strconv.Atoi(offsetString)
-				replica.measuredOffset = measuredOffset
+		offsetString, _ := array[2].asString()
+		measuredOffset, _ := strconv.Atoi(offsetString)
 
-				if replica.measuredOffset == replica.expectedOffset-n {
-					ack <- true
-					return
-				}
-			}
+		status.storeLock.Lock()
+		replica.measuredOffset = measuredOffset
+		status.storeLock.Unlock()
 
+		// The offset acknowledged doesn't count the GETACK itself
+		if measuredOffset >= target {
+			ack <- true
+			return
 		}
 	}
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connectTestReplica registers a replica done with its full resync, and
+// returns the replica's end of the connection.
+func connectTestReplica() net.Conn {
+	replicaEnd, masterEnd := net.Pipe()
+	r := &replica{conn: &connection{handler: masterEnd}}
+	r.startSync()
+	status.replicas["replica"] = r
+
+	return replicaEnd
+}
+
+// newTestClient returns a connection for commands that never reply to it.
+func newTestClient() *connection {
+	handler, _ := net.Pipe()
+	return &connection{handler: handler}
+}
+
+func newCommandQuery(args ...string) *query {
+	q := &query{queryType: Array, value: make([]*query, 0)}
+	for _, arg := range args {
+		q.value = append(q.value.([]*query), &query{queryType: BulkString, value: arg})
+	}
+
+	return q
+}
+
+// runCommand executes a command sent by conn and replicates it the way
+// handleConnection does. It returns the response, or the error.
+func runCommand(conn *connection, args ...string) string {
+	q := newCommandQuery(args...)
+
+	response, command, err := execute(conn, q, nil)
+	if err != nil {
+		return err.Error()
+	}
+
+	if isWriteCommand(command) {
+		replicate(conn.db, q.raw())
+	}
+
+	return string(response)
+}
+
+func TestSelectIsPerConnectionAndReplicatedOnChange(t *testing.T) {
+	setupTestStore()
+	replicaEnd := connectTestReplica()
+
+	first := newTestClient()
+	second := newTestClient()
+	run := runCommand
+
+	run(first, "SELECT", "1")
+	run(first, "DEL", "a")
+	run(first, "DEL", "b")
+	run(second, "DEL", "c")
+	run(first, "DEL", "d")
+
+	if got := run(second, "SELECT", "16"); got != ErrRespDBIndexOutOfRange.Error() {
+		t.Errorf("SELECT 16 = %q, want %q", got, ErrRespDBIndexOutOfRange.Error())
+	}
+
+	if first.db != 1 || second.db != 0 {
+		t.Errorf("selected databases = %d, %d, want 1, 0", first.db, second.db)
+	}
+
+	want := []string{"SELECT 1", "DEL a", "DEL b", "SELECT 0", "DEL c", "SELECT 1", "DEL d"}
+	if got := readReplicationStream(t, replicaEnd, want); got != nil {
+		t.Errorf("replication stream = %v, want %v", got, want)
+	}
+}
+
+// readReplicationStream reads as many bytes from a replica's end of the
+// connection as the commands in want take, and returns the commands read if
+// they differ.
+func readReplicationStream(t *testing.T, conn net.Conn, want []string) []string {
+	t.Helper()
+
+	var wantStream []byte
+	for _, command := range want {
+		wantStream = append(wantStream, encodeRespStringArray(strings.Fields(command))...)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, len(wantStream))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatalf("reading the replication stream: %v", err)
+	}
+
+	if string(b) == string(wantStream) {
+		return nil
+	}
+
+	var got []string
+	for _, line := range strings.Split(string(b), "\r\n") {
+		if line != "" && line[0] != '*' && line[0] != '$' {
+			got = append(got, line)
+		}
+	}
+
+	return got
+}
+
+func TestWaitReleasesTheStoreLock(t *testing.T) {
+	setupTestStore()
+	replicaEnd := connectTestReplica()
+
+	runLocked(func() ([]byte, error) {
+		replicate(0, encodeRespStringArray([]string{"DEL", "a"}))
+		return nil, nil
+	})
+
+	replyC := make(chan []byte)
+	go func() {
+		reply, _ := runLocked(func() ([]byte, error) {
+			return wait([]string{"1", "5000"}, true)
+		})
+		replyC <- reply
+	}()
+
+	readReplicationStream(t, replicaEnd, []string{"SELECT 0", "DEL a", "REPLCONF GETACK *"})
+
+	// Other clients run while WAIT waits for the replica
+	runLocked(func() ([]byte, error) {
+		return set(status.databases[0], []string{"k", "v"})
+	})
+
+	offset := len(encodeRespStringArray([]string{"SELECT", "0"})) + len(encodeRespStringArray([]string{"DEL", "a"}))
+	replicaEnd.Write(encodeRespStringArray([]string{"REPLCONF", "ACK", strconv.Itoa(offset)}))
+
+	select {
+	case reply := <-replyC:
+		if string(reply) != string(encodeRespInteger(1)) {
+			t.Errorf("wait = %q, want 1", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("wait did not return once the replica acknowledged")
+	}
+}
+
+func TestWaitChecksItsArguments(t *testing.T) {
+	setupTestStore()
+	conn := newTestClient()
+
+	for _, args := range [][]string{{"WAIT"}, {"WAIT", "1"}, {"WAIT", "1", "0", "0"}} {
+		if got := runCommand(conn, args...); got != ErrRespWrongNumberOfArguments.Error() {
+			t.Errorf("%v = %q, want %q", args, got, ErrRespWrongNumberOfArguments.Error())
+		}
+	}
+}
+
+func TestFloatIncrementsAreReplicatedAsTheirResult(t *testing.T) {
+	setupTestStore()
+	replicaEnd := connectTestReplica()
+	conn := newTestClient()
+
+	runCommand(conn, "SET", "f", "10.5")
+	runCommand(conn, "INCRBYFLOAT", "f", "0.1")
+	runCommand(conn, "HINCRBYFLOAT", "h", "f", "2.5")
+
+	want := []string{"SELECT 0", "SET f 10.5", "SET f 10.6 KEEPTTL", "HSET h f 2.5"}
+	if got := readReplicationStream(t, replicaEnd, want); got != nil {
+		t.Errorf("replication stream = %v, want %v", got, want)
+	}
+}
+
+func TestTransactionsAreReplicatedWhole(t *testing.T) {
+	setupTestStore()
+	replicaEnd := connectTestReplica()
+	conn := newTestClient()
+
+	multi := []query{
+		*newCommandQuery("INCR", "a"),
+		*newCommandQuery("GET", "a"),
+		*newCommandQuery("SET", "b", "x"),
+		*newCommandQuery("LPUSH", "b", "1"),
+		*newCommandQuery("SELECT", "1"),
+		*newCommandQuery("LPUSH", "l", "1"),
+	}
+
+	got, err := execFunc(conn, multi)
+	if err != nil {
+		t.Fatalf("exec error = %v", err)
+	}
+
+	want := encodeRespArray([][]byte{
+		encodeRespInteger(1),
+		encodeRespBulkString("1"),
+		[]byte("+OK\r\n"),
+		[]byte(ErrRespWrongType.Error()),
+		[]byte("+OK\r\n"),
+		encodeRespInteger(1),
+	})
+	if string(got) != string(want) {
+		t.Errorf("exec = %q, want %q", got, want)
+	}
+
+	// A transaction without writes is not replicated
+	execFunc(conn, []query{*newCommandQuery("GET", "a")})
+	runCommand(conn, "DEL", "l")
+
+	stream := []string{"SELECT 0", "MULTI", "INCR a", "SET b x", "SELECT 1", "LPUSH l 1", "EXEC", "DEL l"}
+	if got := readReplicationStream(t, replicaEnd, stream); got != nil {
+		t.Errorf("replication stream = %v, want %v", got, stream)
+	}
+}
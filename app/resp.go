@@ -3,18 +3,121 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"strconv"
 	"unicode"
 )
 
 var (
-	ErrRespSimpleError            = fmt.Errorf("-ERR")
-	ErrRespWrongNumberOfArguments = fmt.Errorf("%w wrong number of arguments\r\n", ErrRespSimpleError)
-	ErrOutOfBounds                = fmt.Errorf("Requested index is out of bounds")
-	ErrMissingCRLF                = fmt.Errorf("Missing CRLF")
+	ErrRespSimpleError                = fmt.Errorf("-ERR")
+	ErrRespWrongNumberOfArguments     = fmt.Errorf("%w wrong number of arguments\r\n", ErrRespSimpleError)
+	ErrRespNotInteger                 = fmt.Errorf("%w value is not an integer or out of range\r\n", ErrRespSimpleError)
+	ErrRespSyntax                     = fmt.Errorf("%w syntax error\r\n", ErrRespSimpleError)
+	ErrRespNoSuchKey                  = fmt.Errorf("%w no such key\r\n", ErrRespSimpleError)
+	ErrRespIndexOutOfRange            = fmt.Errorf("%w index out of range\r\n", ErrRespSimpleError)
+	ErrRespValueNotPositive           = fmt.Errorf("%w value is out of range, must be positive\r\n", ErrRespSimpleError)
+	ErrRespValueOutOfRange            = fmt.Errorf("%w value is out of range\r\n", ErrRespSimpleError)
+	ErrRespNumKeysNotPositive         = fmt.Errorf("%w numkeys should be greater than 0\r\n", ErrRespSimpleError)
+	ErrRespNumKeysMismatch            = fmt.Errorf("%w Number of keys can't be greater than number of args\r\n", ErrRespSimpleError)
+	ErrRespCountNotPositive           = fmt.Errorf("%w count should be greater than 0\r\n", ErrRespSimpleError)
+	ErrRespLimitNegative              = fmt.Errorf("%w LIMIT can't be negative\r\n", ErrRespSimpleError)
+	ErrRespRankZero                   = fmt.Errorf("%w RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n", ErrRespSimpleError)
+	ErrRespCountNegative              = fmt.Errorf("%w COUNT can't be negative\r\n", ErrRespSimpleError)
+	ErrRespMaxLenNegative             = fmt.Errorf("%w MAXLEN can't be negative\r\n", ErrRespSimpleError)
+	ErrRespTimeoutNotFloat            = fmt.Errorf("%w timeout is not a float or out of range\r\n", ErrRespSimpleError)
+	ErrRespTimeoutNegative            = fmt.Errorf("%w timeout is negative\r\n", ErrRespSimpleError)
+	ErrRespNotFloat                   = fmt.Errorf("%w value is not a valid float\r\n", ErrRespSimpleError)
+	ErrRespHashValueNotInteger        = fmt.Errorf("%w hash value is not an integer\r\n", ErrRespSimpleError)
+	ErrRespHashValueNotFloat          = fmt.Errorf("%w hash value is not a float\r\n", ErrRespSimpleError)
+	ErrRespIncrementOverflow          = fmt.Errorf("%w increment or decrement would overflow\r\n", ErrRespSimpleError)
+	ErrRespDecrementOverflow          = fmt.Errorf("%w decrement would overflow\r\n", ErrRespSimpleError)
+	ErrRespValueNaNOrInfinity         = fmt.Errorf("%w value is NaN or Infinity\r\n", ErrRespSimpleError)
+	ErrRespIncrementNaNOrInfinity     = fmt.Errorf("%w increment would produce NaN or Infinity\r\n", ErrRespSimpleError)
+	ErrRespInvalidCursor              = fmt.Errorf("%w invalid cursor\r\n", ErrRespSimpleError)
+	ErrRespFieldsArgumentMissing      = fmt.Errorf("%w Mandatory argument FIELDS is missing or not at the right position\r\n", ErrRespSimpleError)
+	ErrRespNumFieldsNotPositive       = fmt.Errorf("%w Parameter `numFields` should be greater than 0\r\n", ErrRespSimpleError)
+	ErrRespNumFieldsMismatch          = fmt.Errorf("%w The `numfields` parameter must match the number of arguments\r\n", ErrRespSimpleError)
+	ErrRespMinMaxNotFloat             = fmt.Errorf("%w min or max is not a float\r\n", ErrRespSimpleError)
+	ErrRespInvalidLexRange            = fmt.Errorf("%w min or max not valid string range item\r\n", ErrRespSimpleError)
+	ErrRespXXAndNX                    = fmt.Errorf("%w XX and NX options at the same time are not compatible\r\n", ErrRespSimpleError)
+	ErrRespGTLTAndNX                  = fmt.Errorf("%w GT, LT, and/or NX options at the same time are not compatible\r\n", ErrRespSimpleError)
+	ErrRespIncrSinglePair             = fmt.Errorf("%w INCR option supports a single increment-element pair\r\n", ErrRespSimpleError)
+	ErrRespScoreNaN                   = fmt.Errorf("%w resulting score is not a number (NaN)\r\n", ErrRespSimpleError)
+	ErrRespLimitWithoutByScoreOrByLex = fmt.Errorf("%w syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n", ErrRespSimpleError)
+	ErrRespWithScoresAndByLex         = fmt.Errorf("%w syntax error, WITHSCORES not supported in combination with BYLEX\r\n", ErrRespSimpleError)
+	ErrRespWeightNotFloat             = fmt.Errorf("%w weight value is not a float\r\n", ErrRespSimpleError)
+	ErrRespStringTooLong              = fmt.Errorf("%w string exceeds maximum allowed size (proto-max-bulk-len)\r\n", ErrRespSimpleError)
+	ErrRespOffsetOutOfRange           = fmt.Errorf("%w offset is out of range\r\n", ErrRespSimpleError)
+	ErrRespLCSLenAndIdx               = fmt.Errorf("%w If you want both the length and indexes, please just use IDX.\r\n", ErrRespSimpleError)
+	ErrRespNXAndXXGTLT                = fmt.Errorf("%w NX and XX, GT or LT options at the same time are not compatible\r\n", ErrRespSimpleError)
+	ErrRespGTAndLT                    = fmt.Errorf("%w GT and LT options at the same time are not compatible\r\n", ErrRespSimpleError)
+	ErrRespSameObject                 = fmt.Errorf("%w source and destination objects are the same\r\n", ErrRespSimpleError)
+	ErrRespDBIndexOutOfRange          = fmt.Errorf("%w DB index is out of range\r\n", ErrRespSimpleError)
+	ErrRespInvalidFirstDBIndex        = fmt.Errorf("%w invalid first DB index\r\n", ErrRespSimpleError)
+	ErrRespInvalidSecondDBIndex       = fmt.Errorf("%w invalid second DB index\r\n", ErrRespSimpleError)
+	ErrRespInvalidStreamID            = fmt.Errorf("%w Invalid stream ID specified as stream command argument\r\n", ErrRespSimpleError)
+	ErrRespXGroupKeyMissing           = fmt.Errorf("%w The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n", ErrRespSimpleError)
+	ErrRespXReadGroupMissingGroup     = fmt.Errorf("%w Missing GROUP option for XREADGROUP\r\n", ErrRespSimpleError)
+	ErrRespTimeoutNotInteger          = fmt.Errorf("%w timeout is not an integer or out of range\r\n", ErrRespSimpleError)
+	ErrRespInvalidMinIdleTime         = fmt.Errorf("%w Invalid min-idle-time argument for XCLAIM\r\n", ErrRespSimpleError)
+	ErrRespXAutoClaimCountOutOfRange  = fmt.Errorf("%w COUNT must be > 0\r\n", ErrRespSimpleError)
+	ErrRespMaxLenAndMinID             = fmt.Errorf("%w syntax error, MAXLEN and MINID options at the same time are not compatible\r\n", ErrRespSimpleError)
+	ErrRespNegativeMaxLen             = fmt.Errorf("%w The MAXLEN argument must be >= 0.\r\n", ErrRespSimpleError)
+	ErrRespNegativeLimit              = fmt.Errorf("%w The LIMIT argument must be >= 0.\r\n", ErrRespSimpleError)
+	ErrRespLimitWithoutApprox         = fmt.Errorf("%w syntax error, LIMIT cannot be used without the special ~ option\r\n", ErrRespSimpleError)
+	ErrRespInvalidEntriesRead         = fmt.Errorf("%w value for ENTRIESREAD must be positive or -1\r\n", ErrRespSimpleError)
+	ErrRespXAddIDZero                 = fmt.Errorf("%w The ID specified in XADD must be greater than 0-0\r\n", ErrRespSimpleError)
+	ErrRespXAddIDTooSmall             = fmt.Errorf("%w The ID specified in XADD is equal or smaller than the target stream top item\r\n", ErrRespSimpleError)
+	ErrRespBusyGroup                  = fmt.Errorf("-BUSYGROUP Consumer Group name already exists\r\n")
+	ErrRespNoGroup                    = fmt.Errorf("-NOGROUP")
+	ErrRespWrongType                  = fmt.Errorf("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	ErrOutOfBounds                    = fmt.Errorf("Requested index is out of bounds")
+	ErrMissingCRLF                    = fmt.Errorf("Missing CRLF")
 )
 
+func errInvalidExpireTime(commandName string) error {
+	return fmt.Errorf("%w invalid expire time in '%s' command\r\n", ErrRespSimpleError, commandName)
+}
+
+func errUnsupportedOption(option string) error {
+	return fmt.Errorf("%w Unsupported option %s\r\n", ErrRespSimpleError, option)
+}
+
+func errUnknownSubcommand(subcommand string, commandName string) error {
+	return fmt.Errorf("%w unknown subcommand '%s'. Try %s HELP.\r\n", ErrRespSimpleError, subcommand, commandName)
+}
+
+func errUnrecognizedXClaimOption(option string) error {
+	return fmt.Errorf("%w Unrecognized XCLAIM option '%s'\r\n", ErrRespSimpleError, option)
+}
+
+func errUnbalancedStreams(commandName string) error {
+	orDollar := " or '$'"
+	if commandName == "xreadgroup" {
+		orDollar = ""
+	}
+
+	return fmt.Errorf("%w Unbalanced '%s' list of streams: for each stream key an ID%s must be specified.\r\n", ErrRespSimpleError, commandName, orDollar)
+}
+
+func errNoGroup(key string, group string) error {
+	return fmt.Errorf("%w No such key '%s' or consumer group '%s'\r\n", ErrRespNoGroup, key, group)
+}
+
+func errAtLeastOneInputKey(commandName string) error {
+	return fmt.Errorf("%w at least 1 input key is needed for '%s' command\r\n", ErrRespSimpleError, commandName)
+}
+
+// Errors that do not use the generic `-ERR` prefix must be listed here
+// for them to be sent back to the client.
+func isRespError(err error) bool {
+	return errors.Is(err, ErrRespSimpleError) ||
+		errors.Is(err, ErrRespWrongType) ||
+		errors.Is(err, ErrRespBusyGroup) ||
+		errors.Is(err, ErrRespNoGroup)
+}
+
 type queryType int
 
 const (
@@ -259,6 +362,15 @@ func encodeRespInteger(i int) []byte {
 	return []byte(fmt.Sprintf(":%d\r\n", i))
 }
 
+func encodeRespIntegerArray(a []int) []byte {
+	response := []byte(fmt.Sprintf("*%d\r\n", len(a)))
+	for _, i := range a {
+		response = append(response, encodeRespInteger(i)...)
+	}
+
+	return response
+}
+
 func encodeRespArray(nestedBuffer [][]byte) []byte {
 	buf := make([]byte, 0)
 
@@ -413,12 +413,7 @@ var EMPTY_RDB_FILE = generateEmptyRDBFile()
 
 func generateEmptyRDBFile() []byte {
 	databases := make(map[int]database)
-	db := database{
-		stringStore: make(map[string]stringEntry),
-		streamStore: make(map[string]stream),
-	}
-
-	databases[0] = db
+	databases[0] = newDatabase(0)
 
 	file, _ := encodeRDBFile(databases)
 	return file
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// SCAN and its HSCAN, SSCAN and ZSCAN variants iterate in the order of a
+// 64 bit hash of the elements, the cursor being the smallest hash not
+// visited yet. Unlike an offset in a Go map, whose iteration order is random
+// and changes as it grows, this order does not depend on the layout of the
+// collection, so an element present for the whole iteration is returned
+// exactly once, no matter what is added or removed in between.
+//
+// The keys of a database and the elements of hashes, sets and sorted sets
+// are kept in a scanIndex, a skiplist ordered by that hash, so that a call
+// finds its page in O(log n + COUNT) instead of going through the whole
+// collection.
+
+const (
+	scanDefaultCount = 10
+	// Like Redis for small encodings, collections up to this size are
+	// returned in a single call, ignoring COUNT
+	scanSmallCollectionSize = 128
+)
+
+type scanOptions struct {
+	cursor   uint64
+	pattern  string
+	count    int
+	keyType  string
+	noValues bool
+}
+
+// parseScanOptions parses the cursor and the options shared by the SCAN
+// family of commands. TYPE is only accepted by SCAN and NOVALUES by HSCAN.
+func parseScanOptions(cursor string, options []string, allowType bool, allowNoValues bool) (scanOptions, error) {
+	parsed := scanOptions{pattern: "*", count: scanDefaultCount}
+
+	c, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return parsed, ErrRespInvalidCursor
+	}
+	parsed.cursor = c
+
+	for i := 0; i < len(options); i++ {
+		if strings.EqualFold(options[i], "MATCH") && i+1 < len(options) {
+			parsed.pattern = options[i+1]
+			i++
+		} else if strings.EqualFold(options[i], "COUNT") && i+1 < len(options) {
+			count, err := parseInteger(options[i+1])
+			if err != nil {
+				return parsed, err
+			}
+
+			if count < 1 {
+				return parsed, ErrRespSyntax
+			}
+
+			parsed.count = count
+			i++
+		} else if allowType && strings.EqualFold(options[i], "TYPE") && i+1 < len(options) {
+			parsed.keyType = strings.ToLower(options[i+1])
+			i++
+		} else if allowNoValues && strings.EqualFold(options[i], "NOVALUES") {
+			parsed.noValues = true
+		} else {
+			return parsed, ErrRespSyntax
+		}
+	}
+
+	return parsed, nil
+}
+
+func scanHash(element string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(element))
+
+	return h.Sum64()
+}
+
+const (
+	scanIndexMaxLevel    = 32
+	scanIndexProbability = 0.25
+)
+
+type scanIndexNode struct {
+	hash    uint64
+	element string
+	forward []*scanIndexNode
+}
+
+// before reports whether the node sorts strictly before (hash, element).
+// Elements sharing a hash are ordered lexicographically.
+func (n *scanIndexNode) before(hash uint64, element string) bool {
+	return n.hash < hash || (n.hash == hash && n.element < element)
+}
+
+type scanIndex struct {
+	header *scanIndexNode
+	length int
+	level  int
+}
+
+func newScanIndex() *scanIndex {
+	return &scanIndex{
+		header: &scanIndexNode{forward: make([]*scanIndexNode, scanIndexMaxLevel)},
+		level:  1,
+	}
+}
+
+func randomScanIndexLevel() int {
+	level := 1
+	for level < scanIndexMaxLevel && rand.Float64() < scanIndexProbability {
+		level++
+	}
+
+	return level
+}
+
+// path returns, for each level, the last node sorting before (hash,
+// element).
+func (idx *scanIndex) path(hash uint64, element string) []*scanIndexNode {
+	update := make([]*scanIndexNode, scanIndexMaxLevel)
+
+	x := idx.header
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].before(hash, element) {
+			x = x.forward[i]
+		}
+
+		update[i] = x
+	}
+
+	return update
+}
+
+// insert adds element, if not present yet.
+func (idx *scanIndex) insert(element string) {
+	hash := scanHash(element)
+	update := idx.path(hash, element)
+
+	if next := update[0].forward[0]; next != nil && next.hash == hash && next.element == element {
+		return
+	}
+
+	level := randomScanIndexLevel()
+	if level > idx.level {
+		for i := idx.level; i < level; i++ {
+			update[i] = idx.header
+		}
+
+		idx.level = level
+	}
+
+	x := &scanIndexNode{hash: hash, element: element, forward: make([]*scanIndexNode, level)}
+	for i := 0; i < level; i++ {
+		x.forward[i] = update[i].forward[i]
+		update[i].forward[i] = x
+	}
+
+	idx.length++
+}
+
+// remove deletes element, if present.
+func (idx *scanIndex) remove(element string) {
+	hash := scanHash(element)
+	update := idx.path(hash, element)
+
+	x := update[0].forward[0]
+	if x == nil || x.hash != hash || x.element != element {
+		return
+	}
+
+	for i := 0; i < idx.level; i++ {
+		if update[i].forward[i] == x {
+			update[i].forward[i] = x.forward[i]
+		}
+	}
+
+	for idx.level > 1 && idx.header.forward[idx.level-1] == nil {
+		idx.level--
+	}
+
+	idx.length--
+}
+
+// page returns the elements of the next page of an iteration starting at
+// `cursor`, and the cursor of the page after it, 0 once the iteration is
+// complete. A page holds `count` elements, more if the last hash is shared
+// by several elements, so that a page never ends in the middle of a hash.
+func (idx *scanIndex) page(cursor uint64, count int) ([]string, uint64) {
+	page := make([]string, 0, min(count, idx.length))
+
+	x := idx.path(cursor, "")[0].forward[0]
+	for ; x != nil && len(page) < count; x = x.forward[0] {
+		page = append(page, x.element)
+	}
+
+	if len(page) == 0 {
+		return page, 0
+	}
+
+	last := scanHash(page[len(page)-1])
+	for ; x != nil && x.hash == last; x = x.forward[0] {
+		page = append(page, x.element)
+	}
+
+	if x == nil || last == math.MaxUint64 {
+		return page, 0
+	}
+
+	return page, last + 1
+}
+
+// elements returns every element, in the order of an iteration.
+func (idx *scanIndex) elements() []string {
+	elements := make([]string, 0, idx.length)
+	for x := idx.header.forward[0]; x != nil; x = x.forward[0] {
+		elements = append(elements, x.element)
+	}
+
+	return elements
+}
+
+// scanCollection returns the next page of an HSCAN, SSCAN or ZSCAN over the
+// collection indexed by `index`, filtered by the MATCH pattern. Small
+// collections are returned whole, with a 0 cursor.
+func scanCollection(options scanOptions, index *scanIndex) ([]string, uint64) {
+	var page []string
+	var cursor uint64
+
+	if index.length <= scanSmallCollectionSize {
+		page = index.elements()
+	} else {
+		page, cursor = index.page(options.cursor, options.count)
+	}
+
+	elements := make([]string, 0, len(page))
+	for _, element := range page {
+		if globMatch(options.pattern, element) {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements, cursor
+}
+
+// encodeScanReply encodes the cursor and elements replied by the SCAN family
+// of commands.
+func encodeScanReply(cursor uint64, elements []string) []byte {
+	return encodeRespArray([][]byte{
+		encodeRespBulkString(strconv.FormatUint(cursor, 10)),
+		encodeRespStringArray(elements),
+	})
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+// MATCH and TYPE filter a page once selected, so a page may be empty while
+// the iteration is not over. Expired keys are reclaimed along the way and
+// never returned.
+func scan(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	options, err := parseScanOptions(args[0], args[1:], true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	page, cursor := db.keys.page(options.cursor, options.count)
+
+	keys := make([]string, 0, len(page))
+	for _, key := range page {
+		if !globMatch(options.pattern, key) {
+			continue
+		}
+
+		keyType := db.lookupKey(key)
+		if keyType == "none" || (options.keyType != "" && keyType != options.keyType) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return encodeScanReply(cursor, keys), nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestScanReturnsStableElementsOnce(t *testing.T) {
+	index := newScanIndex()
+	for i := 0; i < 300; i++ {
+		index.insert(fmt.Sprintf("stable%d", i))
+		index.insert(fmt.Sprintf("volatile%d", i))
+	}
+
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	pages := 0
+
+	for {
+		var page []string
+		page, cursor = index.page(cursor, 10)
+		for _, element := range page {
+			seen[element]++
+		}
+
+		// Shrink then grow the collection between pages
+		pages++
+		index.remove(fmt.Sprintf("volatile%d", pages))
+		for i := 0; i < 20; i++ {
+			index.insert(fmt.Sprintf("added%d-%d", pages, i))
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 300; i++ {
+		element := fmt.Sprintf("stable%d", i)
+		if seen[element] != 1 {
+			t.Errorf("%s returned %d times, want 1", element, seen[element])
+		}
+	}
+
+	for element, n := range seen {
+		if n > 1 {
+			t.Errorf("%s returned %d times", element, n)
+		}
+	}
+}
+
+func TestScanIndex(t *testing.T) {
+	index := newScanIndex()
+	for i := 0; i < 1000; i++ {
+		index.insert(strconv.Itoa(i))
+	}
+
+	index.insert("1")
+	for i := 0; i < 1000; i += 2 {
+		index.remove(strconv.Itoa(i))
+	}
+	index.remove("missing")
+
+	elements := index.elements()
+	if index.length != 500 || len(elements) != 500 {
+		t.Fatalf("length = %d with %d elements, want 500", index.length, len(elements))
+	}
+
+	if !slices.IsSortedFunc(elements, func(a, b string) int { return cmp.Compare(scanHash(a), scanHash(b)) }) {
+		t.Errorf("elements are not in the order of their hash")
+	}
+
+	page, cursor := index.page(scanHash(elements[100]), 50)
+	if !slices.Equal(page, elements[100:150]) || cursor != scanHash(elements[149])+1 {
+		t.Errorf("page from the 100th element = %v, %d, want %v, %d", page, cursor, elements[100:150], scanHash(elements[149])+1)
+	}
+
+	page, cursor = index.page(scanHash(elements[490]), 50)
+	if !slices.Equal(page, elements[490:]) || cursor != 0 {
+		t.Errorf("last page = %v, %d, want %v, 0", page, cursor, elements[490:])
+	}
+}
+
+func TestCollectionScans(t *testing.T) {
+	db := setupTestStore()
+
+	for i := 0; i < 500; i++ {
+		hset(db, []string{"h", fmt.Sprintf("f%d", i), "v"})
+		sadd(db, []string{"s", fmt.Sprintf("m%d", i)})
+		zadd(db, []string{"z", strconv.Itoa(i), fmt.Sprintf("m%d", i)})
+	}
+	hdel(db, []string{"h", "f0"})
+	srem(db, []string{"s", "m0"})
+	zrem(db, []string{"z", "m0"})
+
+	tests := []struct {
+		name string
+		f    func(database, []string) ([]byte, error)
+		args []string
+		// Elements per member, with their value or score
+		stride int
+		want   int
+	}{
+		{"hscan", hscan, []string{"h"}, 2, 499},
+		{"hscan", hscan, []string{"h", "NOVALUES"}, 1, 499},
+		{"sscan", sscan, []string{"s"}, 1, 499},
+		{"zscan", zscan, []string{"z", "MATCH", "m1*"}, 2, 111},
+	}
+
+	for _, tt := range tests {
+		found := make(map[string]bool)
+		cursor := "0"
+		for {
+			reply, err := tt.f(db, append([]string{tt.args[0], cursor}, tt.args[1:]...))
+			if err != nil {
+				t.Fatalf("%s %v error = %v", tt.name, tt.args, err)
+			}
+
+			q, _ := readResp(bufio.NewReader(bytes.NewReader(reply)))
+			arr, _ := q.asArray()
+			cursor, _ = arr[0].asString()
+			elements, _ := arr[1].asStringArray()
+			for i := 0; i < len(elements); i += tt.stride {
+				found[elements[i]] = true
+			}
+
+			if cursor == "0" {
+				break
+			}
+		}
+
+		if len(found) != tt.want {
+			t.Errorf("%s %v found %d members, want %d", tt.name, tt.args, len(found), tt.want)
+		}
+	}
+}
+
+func TestScanFilters(t *testing.T) {
+	db := setupTestStore()
+
+	for i := 0; i < 50; i++ {
+		set(db, []string{fmt.Sprintf("user:%d", i), "v"})
+		sadd(db, []string{fmt.Sprintf("set:%d", i), "m"})
+	}
+
+	tests := []struct {
+		options []string
+		want    int
+	}{
+		{[]string{}, 100},
+		{[]string{"MATCH", "user:*"}, 50},
+		{[]string{"TYPE", "set"}, 50},
+		{[]string{"MATCH", "user:*", "TYPE", "set"}, 0},
+		{[]string{"COUNT", "7", "MATCH", "set:1?"}, 10},
+	}
+
+	for _, tt := range tests {
+		found := 0
+		cursor := "0"
+		for {
+			reply, err := scan(db, append([]string{cursor}, tt.options...))
+			if err != nil {
+				t.Fatalf("scan %v error = %v", tt.options, err)
+			}
+
+			q, err := readResp(bufio.NewReader(bytes.NewReader(reply)))
+			if err != nil {
+				t.Fatalf("scan %v replied %q: %v", tt.options, reply, err)
+			}
+
+			arr, _ := q.asArray()
+			cursor, _ = arr[0].asString()
+			keys, _ := arr[1].asStringArray()
+			found += len(keys)
+
+			if cursor == "0" {
+				break
+			}
+		}
+
+		if found != tt.want {
+			t.Errorf("scan %v found %d keys, want %d", tt.options, found, tt.want)
+		}
+	}
+}
+
+func TestScanAfterStringWrites(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(db database)
+		want  []string
+	}{
+		{"mset", func(db database) { mset(db, []string{"a", "2", "b", "3"}) }, []string{"a", "b"}},
+		{"msetnx", func(db database) { msetnx(db, []string{"b", "2", "c", "3"}) }, []string{"a", "b", "c"}},
+		{"getset", func(db database) { getset(db, []string{"b", "2"}) }, []string{"a", "b"}},
+		{"setrange", func(db database) { setrange(db, []string{"b", "0", "x"}) }, []string{"a", "b"}},
+		{"incrbyfloat", func(db database) { incrbyfloat(db, []string{"b", "1.5"}) }, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestStore()
+			set(db, []string{"a", "1"})
+			tt.write(db)
+
+			reply, err := scan(db, []string{"0"})
+			if err != nil {
+				t.Fatalf("scan error = %v", err)
+			}
+
+			q, _ := readResp(bufio.NewReader(bytes.NewReader(reply)))
+			arr, _ := q.asArray()
+			cursor, _ := arr[0].asString()
+			keys, _ := arr[1].asStringArray()
+			slices.Sort(keys)
+
+			if cursor != "0" || !slices.Equal(keys, tt.want) {
+				t.Errorf("scan 0 = %s %v, want 0 %v", cursor, keys, tt.want)
+			}
+		})
+	}
+}
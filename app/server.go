@@ -17,10 +17,21 @@ type connection struct {
 	port    int
 	handler net.Conn
 	mu      sync.Mutex
+	// Index of the database selected with SELECT
+	db int
+
+	// Set while the queued commands of a transaction run,
+	// blocking commands must not block then.
+	inTransaction bool
+
+	// Closed once the client disconnected
+	closed chan struct{}
 }
 
 type instanceStatus struct {
-	globalLock    sync.Mutex
+	// Held while a command executes so commands from different clients
+	// never interleave
+	storeLock     sync.Mutex
 	replId        string
 	replOffset    int
 	replicas      map[string]*replica // indexed by conn.RemoteAddr().String()
@@ -34,8 +45,28 @@ type instanceStatus struct {
 	// One redis instance can host several databases
 	// Each database has several stores.
 	// One per data type.
-	activeDB  int
 	databases map[int]database
+	// Number of databases clients can SELECT
+	databaseCount int
+	// Database selected in the replication stream, -1 if replicas have not
+	// been told yet
+	replicationDB int
+	// Set while EXEC runs, the transaction is opened in the replication
+	// stream along with the first command replicated from it
+	inExec           bool
+	execOpenedInRepl bool
+	// Set while a command received from the master runs
+	inMasterCommand bool
+	// closed channel of the client whose command runs, so that blocking
+	// commands give up when it disconnects
+	clientClosed <-chan struct{}
+
+	// Clients blocked on a key, per database, in the order they blocked
+	blockedClients map[int]map[string][]*blockedClient
+	// Keys that may serve blocked clients once the current command is over
+	readyKeys []readyKey
+
+	expireStats expireStats
 }
 
 func (status *instanceStatus) findReplica(conn net.Conn) *replica {
@@ -59,8 +90,13 @@ func main() {
 	flag.StringVar(&status.replicaof, "replicaof", "", "address and port of redis instance to follow")
 	flag.StringVar(&status.dir, "dir", "", "directory to store the database")
 	flag.StringVar(&status.dbFileName, "dbfilename", "dump.rdb", "name of the database file")
+	flag.IntVar(&status.databaseCount, "databases", defaultDatabaseCount, "number of databases")
 	flag.Parse()
 
+	if status.databaseCount < 1 {
+		errorLogger.Fatalln(fmt.Errorf("Invalid number of databases: %d", status.databaseCount))
+	}
+
 	err := initStore()
 	if err != nil {
 		if errors.Is(err, ErrMissingRDBFile) {
@@ -75,6 +111,11 @@ func main() {
 		errorLogger.Fatalln(err)
 	}
 
+	// Replicas wait for their master to tell them what expired
+	if status.replicaof == "" {
+		go activeExpireLoop()
+	}
+
 	l, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", *port))
 	if err != nil {
 		errorLogger.Fatalln(fmt.Errorf("Failed to start instance: err = %w", err))
@@ -97,28 +138,27 @@ func main() {
 			continue
 		}
 
-		status.globalLock.Lock()
-
 		conn := connection{
 			handler: handler,
 			port:    handler.RemoteAddr().(*net.TCPAddr).Port,
 		}
 
 		go handleConnection(&conn, false, errorC)
-		status.globalLock.Unlock()
 	}
 
 }
 
-func handleConnection(conn *connection, connectionToMaster bool, errorC chan error) {
-	var multi []query = nil
+// readQueries sends the queries received on conn to `queries`. It keeps
+// reading while a command runs, so that a client disconnecting while one of
+// its commands blocks is noticed. Both `queries` and conn.closed are closed
+// once the connection is.
+func readQueries(conn *connection, queries chan<- *query, errorC chan error) {
+	defer close(queries)
+	defer close(conn.closed)
 
 	reader := bufio.NewReader(conn.handler)
 
 	for {
-		status.globalLock.Lock()
-		status.globalLock.Unlock()
-
 		conn.mu.Lock()
 		conn.handler.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
 		q, err := readResp(reader)
@@ -127,18 +167,42 @@ func handleConnection(conn *connection, connectionToMaster bool, errorC chan err
 		if err != nil {
 			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
 				continue
-			} else if err == io.EOF {
-				continue
-			} else {
-				conn.handler.Close()
+			}
+
+			conn.handler.Close()
+			if err != io.EOF {
 				errorC <- err
-				return
 			}
+
+			return
 		}
 
+		queries <- q
+	}
+}
+
+func handleConnection(conn *connection, connectionToMaster bool, errorC chan error) {
+	var multi []query = nil
+
+	queries := make(chan *query)
+	conn.closed = make(chan struct{})
+	go readQueries(conn, queries, errorC)
+
+	for q := range queries {
+		status.storeLock.Lock()
+		status.inMasterCommand = connectionToMaster
+		status.clientClosed = conn.closed
 		response, command, err := execute(conn, q, multi)
+		status.inMasterCommand = false
+		status.clientClosed = nil
+		if err == nil && isWriteCommand(command) {
+			replicate(conn.db, q.raw())
+		}
+		serveBlockedClients()
+		status.storeLock.Unlock()
+
 		if err != nil {
-			if !connectionToMaster && errors.Is(err, ErrRespSimpleError) {
+			if !connectionToMaster && isRespError(err) {
 				conn.handler.Write([]byte(err.Error()))
 			}
 
@@ -173,10 +237,6 @@ func handleConnection(conn *connection, connectionToMaster bool, errorC chan err
 		if q.queryType != RDBFile {
 			rawQuery := q.raw()
 			status.replOffset += len(rawQuery)
-
-			if command == SET || command == DEL {
-				go replicate(rawQuery)
-			}
 		}
 	}
 }
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// Members are kept in a slice, indexed by a map, so that SPOP and
+// SRANDMEMBER draw members in constant time. A removed member is replaced
+// by the last one.
+// Methods reading the set accept a nil set, which is empty.
+type memberSet struct {
+	elements  []string
+	index     map[string]int
+	scanIndex *scanIndex
+}
+
+func newMemberSet(members ...string) *memberSet {
+	s := &memberSet{
+		elements:  make([]string, 0, len(members)),
+		index:     make(map[string]int, len(members)),
+		scanIndex: newScanIndex(),
+	}
+
+	for _, member := range members {
+		s.add(member)
+	}
+
+	return s
+}
+
+// add reports whether member was not in the set yet.
+func (s *memberSet) add(member string) bool {
+	if _, ok := s.index[member]; ok {
+		return false
+	}
+
+	s.index[member] = len(s.elements)
+	s.elements = append(s.elements, member)
+	s.scanIndex.insert(member)
+
+	return true
+}
+
+// remove reports whether member was in the set.
+func (s *memberSet) remove(member string) bool {
+	i, ok := s.index[member]
+	if !ok {
+		return false
+	}
+
+	last := len(s.elements) - 1
+	s.elements[i] = s.elements[last]
+	s.index[s.elements[i]] = i
+	s.elements = s.elements[:last]
+	delete(s.index, member)
+	s.scanIndex.remove(member)
+
+	return true
+}
+
+func (s *memberSet) contains(member string) bool {
+	if s == nil {
+		return false
+	}
+
+	_, ok := s.index[member]
+	return ok
+}
+
+func (s *memberSet) len() int {
+	if s == nil {
+		return 0
+	}
+
+	return len(s.elements)
+}
+
+// members returns a copy of the members, that stays valid as the set
+// changes.
+func (s *memberSet) members() []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return slices.Clone(s.elements)
+}
+
+func (s *memberSet) random() string {
+	return s.elements[rand.Intn(len(s.elements))]
+}
+
+func (s *memberSet) clone() *memberSet {
+	return newMemberSet(s.elements...)
+}
+
+// getSet returns the set stored at key, nil if the key does not exist, or
+// ErrRespWrongType if the key holds another data type.
+func getSet(db database, key string) (*memberSet, error) {
+	switch db.lookupKey(key) {
+	case "set":
+		return db.setStore[key], nil
+	case "none":
+		return nil, nil
+	}
+
+	return nil, ErrRespWrongType
+}
+
+// storeSet replaces whatever is stored at key with `s`, deleting the key
+// instead if the set is empty.
+func storeSet(db database, key string, s *memberSet) {
+	db.deleteKey(key)
+
+	if s.len() > 0 {
+		db.setStore[key] = s
+		db.keys.insert(key)
+	}
+}
+
+func sadd(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	s, err := getSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		s = newMemberSet()
+		db.setStore[key] = s
+		db.keys.insert(key)
+	}
+
+	added := 0
+	for _, member := range args[1:] {
+		if s.add(member) {
+			added++
+		}
+	}
+
+	return encodeRespInteger(added), nil
+}
+
+func srem(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	s, err := getSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if s.remove(member) {
+			removed++
+		}
+	}
+
+	if s.len() == 0 {
+		db.deleteKey(key)
+	}
+
+	return encodeRespInteger(removed), nil
+}
+
+func smembers(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	s, err := getSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRespStringArray(s.members()), nil
+}
+
+func sismember(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	s, err := getSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if s.contains(args[1]) {
+		return encodeRespInteger(1), nil
+	}
+
+	return encodeRespInteger(0), nil
+}
+
+func smismember(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	s, err := getSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]int, 0, len(args)-1)
+	for _, member := range args[1:] {
+		if s.contains(member) {
+			results = append(results, 1)
+		} else {
+			results = append(results, 0)
+		}
+	}
+
+	return encodeRespIntegerArray(results), nil
+}
+
+func scard(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	s, err := getSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRespInteger(s.len()), nil
+}
+
+// spop is replicated as an SREM of the popped members, as replicas would
+// otherwise pick members of their own.
+func spop(db database, args []string) ([]byte, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	withCount := len(args) == 2
+	count := 1
+
+	if withCount {
+		var err error
+
+		count, err = parseInteger(args[1])
+		if err != nil || count < 0 {
+			return nil, ErrRespValueNotPositive
+		}
+	}
+
+	s, err := getSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		if withCount {
+			return []byte("*0\r\n"), nil
+		}
+		return []byte("$-1\r\n"), nil
+	}
+
+	var popped []string
+	if count >= s.len() {
+		popped = s.members()
+		db.deleteKey(key)
+	} else {
+		popped = make([]string, 0, count)
+		for range count {
+			member := s.random()
+			s.remove(member)
+			popped = append(popped, member)
+		}
+	}
+
+	if len(popped) > 0 {
+		propagate(db, append([]string{"SREM", key}, popped...)...)
+	}
+
+	if withCount {
+		return encodeRespStringArray(popped), nil
+	}
+
+	return encodeRespBulkString(popped[0]), nil
+}
+
+// srandmember returns distinct members when count is positive, and lets
+// members repeat when it is negative.
+func srandmember(db database, args []string) ([]byte, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	withCount := len(args) == 2
+	count := 1
+
+	if withCount {
+		var err error
+
+		count, err = parseInteger(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		// Its opposite would overflow
+		if count == math.MinInt {
+			return nil, ErrRespValueOutOfRange
+		}
+	}
+
+	s, err := getSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		if withCount {
+			return []byte("*0\r\n"), nil
+		}
+		return []byte("$-1\r\n"), nil
+	}
+
+	var picked []string
+
+	if count < 0 {
+		// Not preallocated, count is only bounded by the client
+		picked = make([]string, 0)
+		for range -count {
+			picked = append(picked, s.random())
+		}
+	} else if count >= s.len() {
+		picked = s.members()
+	} else if count <= s.len()/2 {
+		// Few members are wanted, drawing again the ones already picked
+		// stays cheap
+		seen := make(map[string]struct{}, count)
+		picked = make([]string, 0, count)
+		for len(picked) < count {
+			member := s.random()
+			if _, ok := seen[member]; !ok {
+				seen[member] = struct{}{}
+				picked = append(picked, member)
+			}
+		}
+	} else {
+		// Most members are wanted, shuffling them is about as costly as
+		// the reply
+		picked = s.members()
+		rand.Shuffle(len(picked), func(i, j int) {
+			picked[i], picked[j] = picked[j], picked[i]
+		})
+		picked = picked[:count]
+	}
+
+	if withCount {
+		return encodeRespStringArray(picked), nil
+	}
+
+	return encodeRespBulkString(picked[0]), nil
+}
+
+func smove(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	source, destination, member := args[0], args[1], args[2]
+
+	src, err := getSet(db, source)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := getSet(db, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	if !src.contains(member) {
+		return encodeRespInteger(0), nil
+	}
+
+	if source == destination {
+		return encodeRespInteger(1), nil
+	}
+
+	src.remove(member)
+	if src.len() == 0 {
+		db.deleteKey(source)
+	}
+
+	if dst == nil {
+		dst = newMemberSet()
+		db.setStore[destination] = dst
+		db.keys.insert(destination)
+	}
+
+	dst.add(member)
+
+	return encodeRespInteger(1), nil
+}
+
+type setOperation int
+
+const (
+	setIntersection setOperation = iota
+	setUnion
+	setDifference
+)
+
+// computeSetOperation applies `operation` to the sets stored at `keys`,
+// missing keys being treated as empty sets.
+func computeSetOperation(db database, keys []string, operation setOperation) (*memberSet, error) {
+	sets, err := getSets(db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newMemberSet()
+
+	if operation == setUnion {
+		for _, s := range sets {
+			for _, member := range s.members() {
+				result.add(member)
+			}
+		}
+
+		return result, nil
+	}
+
+	for _, member := range sets[0].members() {
+		keep := true
+
+		for _, s := range sets[1:] {
+			inSet := s.contains(member)
+
+			if (operation == setIntersection && !inSet) ||
+				(operation == setDifference && inSet) {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			result.add(member)
+		}
+	}
+
+	return result, nil
+}
+
+func getSets(db database, keys []string) ([]*memberSet, error) {
+	sets := make([]*memberSet, 0, len(keys))
+	for _, key := range keys {
+		s, err := getSet(db, key)
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, s)
+	}
+
+	return sets, nil
+}
+
+func setOperationCommand(db database, args []string, operation setOperation) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	result, err := computeSetOperation(db, args, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRespStringArray(result.members()), nil
+}
+
+func setOperationStoreCommand(db database, args []string, operation setOperation) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	result, err := computeSetOperation(db, args[1:], operation)
+	if err != nil {
+		return nil, err
+	}
+
+	storeSet(db, args[0], result)
+
+	return encodeRespInteger(result.len()), nil
+}
+
+func sinter(db database, args []string) ([]byte, error) {
+	return setOperationCommand(db, args, setIntersection)
+}
+
+func sunion(db database, args []string) ([]byte, error) {
+	return setOperationCommand(db, args, setUnion)
+}
+
+func sdiff(db database, args []string) ([]byte, error) {
+	return setOperationCommand(db, args, setDifference)
+}
+
+func sinterstore(db database, args []string) ([]byte, error) {
+	return setOperationStoreCommand(db, args, setIntersection)
+}
+
+func sunionstore(db database, args []string) ([]byte, error) {
+	return setOperationStoreCommand(db, args, setUnion)
+}
+
+func sdiffstore(db database, args []string) ([]byte, error) {
+	return setOperationStoreCommand(db, args, setDifference)
+}
+
+// sintercard goes through the smallest set and stops counting once it
+// reaches LIMIT, 0 meaning no limit.
+func sintercard(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	numKeys, err := parseInteger(args[0])
+	if err != nil || numKeys <= 0 {
+		return nil, ErrRespNumKeysNotPositive
+	}
+
+	if numKeys > len(args)-1 {
+		return nil, ErrRespNumKeysMismatch
+	}
+
+	keys := args[1 : numKeys+1]
+	options := args[numKeys+1:]
+	limit := 0
+
+	if len(options) == 2 && strings.EqualFold(options[0], "LIMIT") {
+		limit, err = parseInteger(options[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if limit < 0 {
+			return nil, ErrRespLimitNegative
+		}
+	} else if len(options) != 0 {
+		return nil, ErrRespSyntax
+	}
+
+	sets, err := getSets(db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(sets, func(a, b *memberSet) int {
+		return a.len() - b.len()
+	})
+
+	count := 0
+	for i := 0; i < sets[0].len(); i++ {
+		member := sets[0].elements[i]
+
+		inAll := true
+		for _, s := range sets[1:] {
+			if !s.contains(member) {
+				inAll = false
+				break
+			}
+		}
+
+		if inAll {
+			count++
+			if count == limit {
+				break
+			}
+		}
+	}
+
+	return encodeRespInteger(count), nil
+}
+
+func sscan(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	options, err := parseScanOptions(args[1], args[2:], false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := getSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		return encodeScanReply(0, []string{}), nil
+	}
+
+	members, cursor := scanCollection(options, s.scanIndex)
+
+	return encodeScanReply(cursor, members), nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// setMembers returns the sorted members of the set stored at key.
+func setMembers(t *testing.T, db database, key string) []string {
+	t.Helper()
+
+	got, err := smembers(db, []string{key})
+	if err != nil {
+		t.Fatalf("smembers(%s) error = %v", key, err)
+	}
+
+	return sortedStrings(t, got)
+}
+
+func TestSAddAndSRem(t *testing.T) {
+	db := setupTestStore()
+
+	tests := []struct {
+		name string
+		f    func(database, []string) ([]byte, error)
+		args []string
+		want int
+	}{
+		{"sadd", sadd, []string{"s", "a", "b", "a"}, 2},
+		{"sadd", sadd, []string{"s", "b", "c"}, 1},
+		{"srem", srem, []string{"s", "a", "missing"}, 1},
+		{"srem", srem, []string{"missing", "a"}, 0},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.f(db, tt.args)
+		if err != nil {
+			t.Fatalf("%s(%v) error = %v", tt.name, tt.args, err)
+		}
+
+		if string(got) != string(encodeRespInteger(tt.want)) {
+			t.Errorf("%s(%v) = %q, want %d", tt.name, tt.args, got, tt.want)
+		}
+	}
+
+	if got := setMembers(t, db, "s"); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("members = %v, want [b c]", got)
+	}
+
+	srem(db, []string{"s", "b", "c"})
+	if db.keyExists("s") {
+		t.Errorf("set emptied by srem still exists")
+	}
+}
+
+func TestSPop(t *testing.T) {
+	db := setupTestStore()
+	sadd(db, []string{"s", "a", "b", "c", "d", "e"})
+
+	got, _ := spop(db, []string{"s", "2"})
+	popped := sortedStrings(t, got)
+	if len(popped) != 2 || popped[0] == popped[1] {
+		t.Fatalf("spop 2 = %q, want 2 distinct members", got)
+	}
+
+	left := setMembers(t, db, "s")
+	if len(left) != 3 || slices.Contains(left, popped[0]) || slices.Contains(left, popped[1]) {
+		t.Errorf("members after spop = %v, popped %v", left, popped)
+	}
+
+	got, _ = spop(db, []string{"s"})
+	if len(got) == 0 || got[0] != '$' || db.setStore["s"].len() != 2 {
+		t.Errorf("spop = %q, set length = %d, want a bulk string and 2", got, db.setStore["s"].len())
+	}
+
+	got, _ = spop(db, []string{"s", "10"})
+	if len(sortedStrings(t, got)) != 2 || db.keyExists("s") {
+		t.Errorf("spop of more members than the set holds = %q", got)
+	}
+
+	if got, _ := spop(db, []string{"s"}); string(got) != "$-1\r\n" {
+		t.Errorf("spop on a missing key = %q, want a null reply", got)
+	}
+
+	if _, err := spop(db, []string{"s", "-1"}); err != ErrRespValueNotPositive {
+		t.Errorf("spop with a negative count error = %v, want %v", err, ErrRespValueNotPositive)
+	}
+}
+
+func TestSRandMember(t *testing.T) {
+	db := setupTestStore()
+	members := []string{"a", "b", "c", "d", "e", "f"}
+	sadd(db, append([]string{"s"}, members...))
+
+	for _, count := range []string{"1", "2", "5", "6", "10"} {
+		got, _ := srandmember(db, []string{"s", count})
+		picked := sortedStrings(t, got)
+		want, _ := parseInteger(count)
+
+		if len(picked) != min(want, len(members)) || len(slices.Compact(picked)) != len(picked) {
+			t.Errorf("srandmember %s = %q, want %d distinct members", count, got, min(want, len(members)))
+		}
+	}
+
+	got, _ := srandmember(db, []string{"s", "-20"})
+	if picked := sortedStrings(t, got); len(picked) != 20 {
+		t.Errorf("srandmember -20 = %q, want 20 members", got)
+	}
+
+	if db.setStore["s"].len() != len(members) {
+		t.Errorf("srandmember changed the set")
+	}
+
+	if _, err := srandmember(db, []string{"s", "-9223372036854775808"}); err != ErrRespValueOutOfRange {
+		t.Errorf("srandmember with the smallest count error = %v, want %v", err, ErrRespValueOutOfRange)
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	db := setupTestStore()
+	sadd(db, []string{"a", "1", "2", "3", "4"})
+	sadd(db, []string{"b", "2", "3", "5"})
+	sadd(db, []string{"c", "3", "6"})
+
+	tests := []struct {
+		name string
+		f    func(database, []string) ([]byte, error)
+		keys []string
+		want []string
+	}{
+		{"sinter", sinter, []string{"a", "b"}, []string{"2", "3"}},
+		{"sinter", sinter, []string{"a", "b", "c"}, []string{"3"}},
+		{"sinter", sinter, []string{"a", "missing"}, []string{}},
+		{"sunion", sunion, []string{"b", "c", "missing"}, []string{"2", "3", "5", "6"}},
+		{"sdiff", sdiff, []string{"a", "b", "c"}, []string{"1", "4"}},
+		{"sdiff", sdiff, []string{"missing", "a"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.f(db, tt.keys)
+		if err != nil {
+			t.Fatalf("%s(%v) error = %v", tt.name, tt.keys, err)
+		}
+
+		if members := sortedStrings(t, got); !slices.Equal(members, tt.want) {
+			t.Errorf("%s(%v) = %v, want %v", tt.name, tt.keys, members, tt.want)
+		}
+	}
+
+	stores := []struct {
+		name string
+		f    func(database, []string) ([]byte, error)
+		keys []string
+		want []string
+	}{
+		{"sinterstore", sinterstore, []string{"a", "b"}, []string{"2", "3"}},
+		{"sunionstore", sunionstore, []string{"b", "c"}, []string{"2", "3", "5", "6"}},
+		{"sdiffstore", sdiffstore, []string{"a", "b"}, []string{"1", "4"}},
+		{"sdiffstore onto a source", sdiffstore, []string{"dst", "c"}, []string{"1", "4"}},
+	}
+
+	for _, tt := range stores {
+		got, err := tt.f(db, append([]string{"dst"}, tt.keys...))
+		if err != nil {
+			t.Fatalf("%s(%v) error = %v", tt.name, tt.keys, err)
+		}
+
+		if string(got) != string(encodeRespInteger(len(tt.want))) {
+			t.Errorf("%s(%v) = %q, want %d", tt.name, tt.keys, got, len(tt.want))
+		}
+
+		if members := setMembers(t, db, "dst"); !slices.Equal(members, tt.want) {
+			t.Errorf("destination after %s(%v) = %v, want %v", tt.name, tt.keys, members, tt.want)
+		}
+	}
+
+	// An empty result deletes the destination, whatever it held
+	db.stringStore["str"] = stringEntry{value: "v"}
+	sinterstore(db, []string{"str", "a", "missing"})
+	if db.keyExists("str") {
+		t.Errorf("destination of an empty sinterstore still exists")
+	}
+}
+
+func TestSInterCard(t *testing.T) {
+	db := setupTestStore()
+	sadd(db, []string{"a", "1", "2", "3", "4"})
+	sadd(db, []string{"b", "2", "3", "4", "5"})
+
+	tests := []struct {
+		args []string
+		want []byte
+		err  error
+	}{
+		{args: []string{"2", "a", "b"}, want: encodeRespInteger(3)},
+		{args: []string{"2", "a", "b", "LIMIT", "2"}, want: encodeRespInteger(2)},
+		{args: []string{"2", "a", "b", "LIMIT", "10"}, want: encodeRespInteger(3)},
+		{args: []string{"2", "a", "b", "LIMIT", "0"}, want: encodeRespInteger(3)},
+		{args: []string{"2", "a", "missing"}, want: encodeRespInteger(0)},
+		{args: []string{"1", "a"}, want: encodeRespInteger(4)},
+		{args: []string{"0", "a"}, err: ErrRespNumKeysNotPositive},
+		{args: []string{"3", "a", "b"}, err: ErrRespNumKeysMismatch},
+		{args: []string{"2", "a", "b", "LIMIT", "-1"}, err: ErrRespLimitNegative},
+		{args: []string{"2", "a", "b", "COUNT", "1"}, err: ErrRespSyntax},
+	}
+
+	for _, tt := range tests {
+		got, err := sintercard(db, tt.args)
+		if err != tt.err {
+			t.Errorf("sintercard(%v) error = %v, want %v", tt.args, err, tt.err)
+			continue
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("sintercard(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSMove(t *testing.T) {
+	db := setupTestStore()
+	sadd(db, []string{"src", "a", "b"})
+	sadd(db, []string{"dst", "x"})
+
+	tests := []struct {
+		args []string
+		want int
+		src  []string
+		dst  []string
+	}{
+		{[]string{"src", "dst", "a"}, 1, []string{"b"}, []string{"a", "x"}},
+		{[]string{"src", "dst", "missing"}, 0, []string{"b"}, []string{"a", "x"}},
+		{[]string{"src", "src", "b"}, 1, []string{"b"}, []string{"a", "x"}},
+		{[]string{"src", "dst", "b"}, 1, []string{}, []string{"a", "b", "x"}},
+		{[]string{"src", "dst", "b"}, 0, []string{}, []string{"a", "b", "x"}},
+	}
+
+	for _, tt := range tests {
+		got, err := smove(db, tt.args)
+		if err != nil {
+			t.Fatalf("smove(%v) error = %v", tt.args, err)
+		}
+
+		if string(got) != string(encodeRespInteger(tt.want)) {
+			t.Errorf("smove(%v) = %q, want %d", tt.args, got, tt.want)
+		}
+
+		src, dst := setMembers(t, db, "src"), setMembers(t, db, "dst")
+		if !slices.Equal(src, tt.src) || !slices.Equal(dst, tt.dst) {
+			t.Errorf("after smove(%v) source = %v, destination = %v", tt.args, src, dst)
+		}
+	}
+
+	if db.keyExists("src") {
+		t.Errorf("set emptied by smove still exists")
+	}
+
+	smove(db, []string{"dst", "new", "x"})
+	if got := setMembers(t, db, "new"); !slices.Equal(got, []string{"x"}) {
+		t.Errorf("set created by smove = %v, want [x]", got)
+	}
+}
+
+func TestSetCommandsRejectOtherTypes(t *testing.T) {
+	db := setupTestStore()
+	db.stringStore["str"] = stringEntry{value: "v"}
+	sadd(db, []string{"s", "a"})
+
+	tests := []struct {
+		name string
+		f    func() ([]byte, error)
+	}{
+		{"sadd", func() ([]byte, error) { return sadd(db, []string{"str", "a"}) }},
+		{"srem", func() ([]byte, error) { return srem(db, []string{"str", "a"}) }},
+		{"smembers", func() ([]byte, error) { return smembers(db, []string{"str"}) }},
+		{"sismember", func() ([]byte, error) { return sismember(db, []string{"str", "a"}) }},
+		{"scard", func() ([]byte, error) { return scard(db, []string{"str"}) }},
+		{"spop", func() ([]byte, error) { return spop(db, []string{"str"}) }},
+		{"srandmember", func() ([]byte, error) { return srandmember(db, []string{"str"}) }},
+		{"sinter", func() ([]byte, error) { return sinter(db, []string{"s", "str"}) }},
+		{"sunionstore", func() ([]byte, error) { return sunionstore(db, []string{"dst", "s", "str"}) }},
+		{"sintercard", func() ([]byte, error) { return sintercard(db, []string{"2", "s", "str"}) }},
+		{"smove from a string", func() ([]byte, error) { return smove(db, []string{"str", "s", "a"}) }},
+		{"smove to a string", func() ([]byte, error) { return smove(db, []string{"s", "str", "a"}) }},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.f(); err != ErrRespWrongType {
+			t.Errorf("%s error = %v, want %v", tt.name, err, ErrRespWrongType)
+		}
+	}
+
+	// A failed SMOVE leaves the source untouched
+	if got := setMembers(t, db, "s"); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("members after a failed smove = %v, want [a]", got)
+	}
+
+	if db.keyExists("dst") {
+		t.Errorf("failed sunionstore created its destination")
+	}
+}
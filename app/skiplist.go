@@ -0,0 +1,237 @@
+package main
+
+import "math/rand"
+
+// Skiplist ordering sorted set members by score, then lexicographically.
+// Each link stores its span, the number of nodes it jumps over, so ranks
+// can be computed while walking down the levels in O(log n).
+const (
+	skiplistMaxLevel    = 32
+	skiplistProbability = 0.25
+)
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
+}
+
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	levels   []skiplistLevel
+}
+
+type skiplist struct {
+	header *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: &skiplistNode{levels: make([]skiplistLevel, skiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+func randomSkiplistLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistProbability {
+		level++
+	}
+
+	return level
+}
+
+// before reports whether the node sorts strictly before (score, member).
+func (n *skiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds a node, the caller making sure member is not already present.
+func (zsl *skiplist) insert(score float64, member string) *skiplistNode {
+	update := make([]*skiplistNode, skiplistMaxLevel)
+	rank := make([]int, skiplistMaxLevel)
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+
+		update[i] = x
+	}
+
+	level := randomSkiplistLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			update[i] = zsl.header
+			update[i].levels[i].span = zsl.length
+		}
+
+		zsl.level = level
+	}
+
+	x = &skiplistNode{member: member, score: score, levels: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+
+	for i := level; i < zsl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+
+	zsl.length++
+
+	return x
+}
+
+// delete removes the node matching (score, member), if any.
+func (zsl *skiplist) delete(score float64, member string) bool {
+	update := make([]*skiplistNode, skiplistMaxLevel)
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			x = x.levels[i].forward
+		}
+
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < zsl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+
+	for zsl.level > 1 && zsl.header.levels[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+
+	zsl.length--
+
+	return true
+}
+
+// rank returns the 1-based rank of (score, member), or 0 if it is absent.
+func (zsl *skiplist) rank(score float64, member string) int {
+	rank := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil &&
+			(x.levels[i].forward.before(score, member) ||
+				(x.levels[i].forward.score == score && x.levels[i].forward.member == member)) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+
+		if x != zsl.header && x.score == score && x.member == member {
+			return rank
+		}
+	}
+
+	return 0
+}
+
+// nodeByRank returns the node at the given 1-based rank, or nil if out of
+// range.
+func (zsl *skiplist) nodeByRank(rank int) *skiplistNode {
+	traversed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+
+		if traversed == rank && x != zsl.header {
+			return x
+		}
+	}
+
+	return nil
+}
+
+// skiplistRange is a range of nodes, either by score or lexicographical.
+type skiplistRange interface {
+	isEmpty() bool
+	aboveMin(n *skiplistNode) bool
+	belowMax(n *skiplistNode) bool
+}
+
+func (zsl *skiplist) firstInRange(r skiplistRange) *skiplistNode {
+	if r.isEmpty() {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !r.aboveMin(x.levels[i].forward) {
+			x = x.levels[i].forward
+		}
+	}
+
+	x = x.levels[0].forward
+	if x == nil || !r.belowMax(x) {
+		return nil
+	}
+
+	return x
+}
+
+func (zsl *skiplist) lastInRange(r skiplistRange) *skiplistNode {
+	if r.isEmpty() {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && r.belowMax(x.levels[i].forward) {
+			x = x.levels[i].forward
+		}
+	}
+
+	if x == zsl.header || !r.aboveMin(x) {
+		return nil
+	}
+
+	return x
+}
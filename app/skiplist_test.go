@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkiplistRanks(t *testing.T) {
+	z := newSortedSet()
+	expected := make(map[string]float64)
+
+	for i := 0; i < 2000; i++ {
+		member := fmt.Sprintf("m%d", rand.Intn(300))
+
+		if rand.Intn(4) == 0 {
+			z.remove(member)
+			delete(expected, member)
+		} else {
+			score := float64(rand.Intn(50))
+			z.add(member, score)
+			expected[member] = score
+		}
+	}
+
+	members := make([]string, 0, len(expected))
+	for member := range expected {
+		members = append(members, member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		return expected[a] < expected[b] || (expected[a] == expected[b] && a < b)
+	})
+
+	if z.zsl.length != len(members) {
+		t.Fatalf("length = %d, want %d", z.zsl.length, len(members))
+	}
+
+	for i, member := range members {
+		rank, ok := z.rank(member, false)
+		if !ok || rank != i {
+			t.Errorf("rank(%s) = %d, %v, want %d", member, rank, ok, i)
+		}
+
+		node := z.zsl.nodeByRank(i + 1)
+		if node == nil || node.member != member {
+			t.Errorf("nodeByRank(%d) = %v, want %s", i+1, node, member)
+		}
+	}
+
+	r := scoreRange{min: 10, max: 20, minExclusive: true}
+	got := zrangeByRange(z, r, false, 0, -1)
+
+	want := make([]string, 0)
+	for _, member := range members {
+		if expected[member] > 10 && expected[member] <= 20 {
+			want = append(want, member)
+		}
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("range (10 20 returned %d members, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i].member != want[i] {
+			t.Errorf("range (10 20 [%d] = %s, want %s", i, got[i].member, want[i])
+		}
+	}
+}
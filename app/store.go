@@ -1,583 +1,433 @@
 package main
 
 import (
-	"context"
-	"fmt"
+	"container/list"
 	"math"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type stringEntry struct {
-	value     string
-	expiresAt *time.Time
-}
-
-type streamEntry map[string]string
-
-func (entry streamEntry) encode() []byte {
-	encodedId := encodeRespBulkString(entry["id"])
-
-	allKVs := make([][]byte, 0)
-	for k, v := range entry {
-		if k == "id" {
-			continue
-		}
-
-		key := encodeRespBulkString(k)
-		value := encodeRespBulkString(v)
-
-		allKVs = append(allKVs, key)
-		allKVs = append(allKVs, value)
-	}
-
-	encodedKvArray := encodeRespArray(allKVs)
-	encodedEntry := encodeRespArray([][]byte{encodedId, encodedKvArray})
-
-	return encodedEntry
-}
-
-type stream struct {
-	entries []streamEntry
-	lastId  string
+	value string
 }
 
 type database struct {
-	stringStore map[string]stringEntry
-	streamStore map[string]stream
+	id             int
+	stringStore    map[string]stringEntry
+	streamStore    map[string]stream
+	listStore      map[string]*list.List
+	hashStore      map[string]*hash
+	setStore       map[string]*memberSet
+	sortedSetStore map[string]*sortedSet
+	// expires holds the expiry of keys with a TTL, whatever their type
+	expires map[string]time.Time
+	// hashFieldExpires holds the keys of hashes that may have fields with a
+	// TTL, for the active expire cycle. Keys are added where a field gets a
+	// TTL, and dropped by deleteKey or once the cycle finds no TTL left.
+	hashFieldExpires map[string]struct{}
+	// keys indexes the keys of every store for SCAN. Keys are added to it
+	// where they are created, and removed by deleteKey.
+	keys *scanIndex
 }
 
-func initStore() error {
-	status.activeDB = 0
-	status.databases = make(map[int]database)
-	initialDB := database{
-		stringStore: make(map[string]stringEntry),
-		streamStore: make(map[string]stream),
-	}
-	status.databases[0] = initialDB
-
-	if status.dbFileName != "" && status.dir != "" {
-		return initPersistence()
+func newDatabase(id int) database {
+	return database{
+		id:               id,
+		stringStore:      make(map[string]stringEntry),
+		streamStore:      make(map[string]stream),
+		listStore:        make(map[string]*list.List),
+		hashStore:        make(map[string]*hash),
+		setStore:         make(map[string]*memberSet),
+		sortedSetStore:   make(map[string]*sortedSet),
+		expires:          make(map[string]time.Time),
+		hashFieldExpires: make(map[string]struct{}),
+		keys:             newScanIndex(),
 	}
-
-	return nil
 }
 
-var expiryDurationOptionNames = []string{"EX", "PX"}
-
-func isExpiryDurationOption(optionName string) string {
-	for _, opt := range expiryDurationOptionNames {
-		if strings.EqualFold(optionName, opt) {
-			return opt
+// lookupKey is the single path commands take to find a key. A key whose TTL
+// has passed, or a hash whose fields have all expired, is deleted first so
+// that it behaves as absent everywhere. Expired fields of other hashes are
+// left to the commands, which skip them.
+// Replicas leave deletions to the DEL and HDEL of their master, so that both
+// hold the same data: an expired key is only reported missing, and not even
+// that to the master's own commands.
+// It returns the name of the data type stored at key, as reported by the
+// TYPE command, or "none" if the key does not exist.
+func (db database) lookupKey(key string) string {
+	now := time.Now()
+
+	if status.replicaof == "" {
+		db.expireIfNeeded(key)
+
+		if h, ok := db.hashStore[key]; ok && h.allExpired(now) {
+			expireHashFields(db, key, h, now)
 		}
+	} else if !status.inMasterCommand && db.isExpired(key, now) {
+		return "none"
+	} else if h, ok := db.hashStore[key]; ok && h.allExpired(now) {
+		return "none"
 	}
 
-	return ""
-}
+	if _, ok := db.stringStore[key]; ok {
+		return "string"
+	}
 
-func incr(args []string) ([]byte, error) {
-	if len(args) != 1 {
-		return nil, ErrRespWrongNumberOfArguments
+	if _, ok := db.streamStore[key]; ok {
+		return "stream"
 	}
 
-	key := args[0]
+	if _, ok := db.listStore[key]; ok {
+		return "list"
+	}
 
-	entry, ok := status.databases[status.activeDB].stringStore[key]
+	if _, ok := db.hashStore[key]; ok {
+		return "hash"
+	}
 
-	if !ok {
-		entry = stringEntry{
-			value:     "0",
-			expiresAt: nil,
-		}
+	if _, ok := db.setStore[key]; ok {
+		return "set"
 	}
 
-	val, err := strconv.Atoi(entry.value)
-	if err != nil {
-		return nil, fmt.Errorf("%w value is not an integer or out of range\r\n", ErrRespSimpleError)
+	if _, ok := db.sortedSetStore[key]; ok {
+		return "zset"
 	}
-	entry.value = strconv.Itoa(val + 1)
-	status.databases[status.activeDB].stringStore[key] = entry
 
-	return encodeRespInteger(val + 1), nil
+	return "none"
 }
 
-func set(args []string) ([]byte, error) {
-	var expiresAt *time.Time = nil
-	var durationMultiplier time.Duration = 0
-	var duration int = 0
-	var err error
-
-	if len(args) < 2 {
-		return nil, ErrRespWrongNumberOfArguments
-	}
+// setString stores entry at key, adding key to the SCAN index if it is new.
+// Every string write goes through it.
+func (db database) setString(key string, entry stringEntry) {
+	db.stringStore[key] = entry
+	db.keys.insert(key)
+}
 
-	key := args[0]
-	value := args[1]
-	options := args[2:]
+// deleteKey removes key, and its TTL, from whichever store holds it.
+func (db database) deleteKey(key string) bool {
+	delete(db.expires, key)
+	delete(db.hashFieldExpires, key)
+	db.keys.remove(key)
 
-	for i, option := range options {
-		expiryDurationOption := isExpiryDurationOption(option)
+	if _, ok := db.stringStore[key]; ok {
+		delete(db.stringStore, key)
+		return true
+	}
 
-		if expiryDurationOption != "" {
-			if len(options) < i+2 {
-				return nil, ErrOutOfBounds
-			}
+	if _, ok := db.streamStore[key]; ok {
+		delete(db.streamStore, key)
+		return true
+	}
 
-			durationString := options[i+1]
+	if _, ok := db.listStore[key]; ok {
+		delete(db.listStore, key)
+		return true
+	}
 
-			duration, err = strconv.Atoi(durationString)
-			if err != nil {
-				return nil, err
-			}
+	if _, ok := db.hashStore[key]; ok {
+		delete(db.hashStore, key)
+		return true
+	}
 
-			if expiryDurationOption == "PX" {
-				durationMultiplier = time.Millisecond
-			} else if expiryDurationOption == "EX" {
-				durationMultiplier = time.Second
-			}
-		}
+	if _, ok := db.setStore[key]; ok {
+		delete(db.setStore, key)
+		return true
 	}
 
-	if duration > 0 {
-		expiresAt = new(time.Time)
-		*expiresAt = time.Now().Add(time.Duration(duration) * durationMultiplier)
+	if _, ok := db.sortedSetStore[key]; ok {
+		delete(db.sortedSetStore, key)
+		return true
 	}
 
-	status.databases[status.activeDB].stringStore[key] = stringEntry{value: value, expiresAt: expiresAt}
+	return false
+}
 
-	return []byte("+OK\r\n"), nil
+func (db database) keyExists(key string) bool {
+	return db.lookupKey(key) != "none"
 }
 
-func get(args []string) ([]byte, error) {
-	if len(args) != 1 {
-		return nil, ErrRespWrongNumberOfArguments
+// forEachKey calls f with every key of the database, including expired keys
+// that have not been reclaimed yet.
+func (db database) forEachKey(f func(key string)) {
+	for key := range db.stringStore {
+		f(key)
 	}
 
-	key := args[0]
-
-	entry, ok := status.databases[status.activeDB].stringStore[key]
-	if !ok {
-		return []byte("$-1\r\n"), nil
+	for key := range db.streamStore {
+		f(key)
 	}
 
-	if entry.expiresAt != nil && entry.expiresAt.Before(time.Now()) {
-		delete(status.databases[status.activeDB].stringStore, key)
-		return []byte("$-1\r\n"), nil
+	for key := range db.listStore {
+		f(key)
 	}
 
-	return encodeRespBulkString(entry.value), nil
-}
-
-func del(args []string) ([]byte, error) {
-	if len(args) < 1 {
-		return nil, ErrRespWrongNumberOfArguments
+	for key := range db.hashStore {
+		f(key)
 	}
 
-	keys := args
-
-	deleted := 0
-	for _, key := range keys {
-		if _, ok := status.databases[status.activeDB].stringStore[key]; ok {
-			delete(status.databases[status.activeDB].stringStore, key)
-			deleted++
-		}
+	for key := range db.setStore {
+		f(key)
 	}
 
-	return encodeRespInteger(deleted), nil
-}
-
-func selectFunc(args []string) []byte {
-	status.activeDB, _ = strconv.Atoi(args[0])
-	if _, ok := status.databases[status.activeDB]; !ok {
-		newDB := database{
-			stringStore: make(map[string]stringEntry),
-			streamStore: make(map[string]stream),
-		}
-		status.databases[status.activeDB] = newDB
+	for key := range db.sortedSetStore {
+		f(key)
 	}
-
-	return []byte("+OK\r\n")
 }
 
-func keys(args []string) ([]byte, error) {
-	if len(args) != 1 {
-		return nil, ErrRespWrongNumberOfArguments
-	}
-
-	pattern := args[0]
-	if pattern == "*" {
-		pattern = ".*"
-	}
-	regex, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, err
-	}
+const defaultDatabaseCount = 16
 
-	keys := make([]string, 0)
+func initStore() error {
+	status.replicationDB = -1
+	status.databases = make(map[int]database)
+	status.databases[0] = newDatabase(0)
+	initBlocking()
 
-	for key := range status.databases[status.activeDB].stringStore {
-		if regex.MatchString(key) {
-			keys = append(keys, key)
-		}
+	if status.dbFileName != "" && status.dir != "" {
+		return initPersistence()
 	}
 
-	return encodeRespStringArray(keys), nil
+	return nil
 }
 
-func typeFunc(args []string) ([]byte, error) {
-	if len(args) != 1 {
+// set is replicated without its NX, XX and GET options, and with its expiry
+// as an absolute PXAT timestamp so that replicas don't compute it relative
+// to their own clock.
+func set(db database, args []string) ([]byte, error) {
+	var nx, xx, get, keepTTL bool
+	var expiresAt *time.Time
+
+	if len(args) < 2 {
 		return nil, ErrRespWrongNumberOfArguments
 	}
 
 	key := args[0]
+	value := args[1]
+	options := args[2:]
+	now := time.Now()
+
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(options[i])
+
+		switch option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if expiresAt != nil || i+1 >= len(options) {
+				return nil, ErrRespSyntax
+			}
 
-	_, inStringStore := status.databases[status.activeDB].stringStore[key]
-	_, inStreamStore := status.databases[status.activeDB].streamStore[key]
-
-	if inStringStore {
-		return encodeRespSimpleString("string"), nil
-	}
-
-	if inStreamStore {
-		return encodeRespSimpleString("stream"), nil
-	}
-
-	return encodeRespSimpleString("none"), nil
-}
-
-func parseStreamEntryId(id string) (int, int, error) {
-	milliseconds := -1
-	seq := -1
+			unit, absolute, _ := parseExpiryOption(option)
 
-	parts := strings.Split(id, "-")
+			expiry, err := parseInteger(options[i+1])
+			if err != nil {
+				return nil, err
+			}
 
-	milliseconds, err := strconv.Atoi(parts[0])
-	if err != nil {
-		if parts[0] == "*" {
-			milliseconds = -1
-		} else {
-			return -1, -1, err
-		}
-	}
+			if expiry <= 0 {
+				return nil, errInvalidExpireTime("set")
+			}
 
-	if len(parts) == 2 {
-		seq, err = strconv.Atoi(parts[1])
-		if err != nil {
-			if parts[1] == "*" {
-				seq = -1
-			} else {
-				return milliseconds, -1, err
+			t, err := expiryTime(expiry, unit, absolute, now)
+			if err != nil {
+				return nil, errInvalidExpireTime("set")
 			}
+
+			expiresAt = &t
+			i++
+		default:
+			return nil, ErrRespSyntax
 		}
 	}
 
-	return milliseconds, seq, nil
-}
-
-// An ID is <milliseconds>-<sequenceNumber>
-// ID of later entries must be superior to id of previous entries
-// - Higher timestamp
-// - If same timestamp, higher seq
-// If `sequenceNumber` is `*` it is auto generated
-// - If same timestamp, previous sequence number + 1
-// - Else 0 (note, 0-0 is illegal. Works out of the box because we use 0-0 as default)
-// TODO refactor, clear code and remove comment
-func validateStreamEntryId(newId string, lastId string) (string, error) {
-	newMs, newSeq, err := parseStreamEntryId(newId)
-	if err != nil {
-		return "", err
+	if (nx && xx) || (keepTTL && expiresAt != nil) {
+		return nil, ErrRespSyntax
 	}
 
-	if newMs == 0 && newSeq == 0 {
-		return "", fmt.Errorf("%w The ID specified in XADD must be greater than 0-0\r\n", ErrRespSimpleError)
+	entry, isString, err := getString(db, key)
+	if err != nil && get {
+		return nil, err
 	}
 
-	lastMs, lastSeq, err := parseStreamEntryId(lastId)
-	if err != nil {
-		return "", err
-	}
+	// A key holding another data type exists too
+	exists := isString || err != nil
 
-	if newMs == -1 {
-		newMs = int(time.Now().UnixMilli())
+	response := []byte("+OK\r\n")
+	if get && isString {
+		response = encodeRespBulkString(entry.value)
+	} else if get {
+		response = []byte("$-1\r\n")
 	}
 
-	if newSeq == -1 {
-		if newMs == lastMs {
-			newSeq = lastSeq + 1
-		} else {
-			newSeq = 0
+	if (nx && exists) || (xx && !exists) {
+		if get {
+			return response, nil
 		}
-	}
 
-	if newMs < lastMs {
-		return "", fmt.Errorf("%w The ID specified in XADD is equal or smaller than the target stream top item\r\n", ErrRespSimpleError)
+		return []byte("$-1\r\n"), nil
 	}
 
-	if newMs == lastMs {
-		if newSeq <= lastSeq {
-			return "", fmt.Errorf("%w The ID specified in XADD is equal or smaller than the target stream top item\r\n", ErrRespSimpleError)
-		}
+	if t, ok := db.expires[key]; ok && keepTTL && isString {
+		expiresAt = &t
 	}
 
-	return fmt.Sprintf("%d-%d", newMs, newSeq), nil
-}
+	// SET overwrites whatever was stored at key, regardless of its type
+	db.deleteKey(key)
 
-func xadd(args []string) ([]byte, error) {
-	var aStream stream
+	if expiresAt != nil && !expiresAt.After(now) {
+		propagate(db, "DEL", key)
+		return response, nil
+	}
 
-	entry := make(map[string]string)
+	db.setString(key, stringEntry{value: value})
 
-	if len(args) < 3 {
-		return nil, ErrRespWrongNumberOfArguments
+	if expiresAt != nil {
+		db.expires[key] = *expiresAt
+		propagate(db, "SET", key, value, "PXAT", strconv.FormatInt(expiresAt.UnixMilli(), 10))
+	} else {
+		propagate(db, "SET", key, value)
 	}
 
-	key := args[0]
-	id := args[1]
-	kv := args[2:]
+	return response, nil
+}
 
-	aStream, ok := status.databases[status.activeDB].streamStore[key]
-	if !ok {
-		aStream = stream{
-			entries: make([]streamEntry, 0),
-			lastId:  "0-0",
-		}
+func get(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
 	}
 
-	validatedId, err := validateStreamEntryId(id, aStream.lastId)
+	entry, ok, err := getString(db, args[0])
 	if err != nil {
 		return nil, err
 	}
 
-	entry["id"] = validatedId
-
-	for i := 0; i+1 < len(kv); i += 2 {
-		entry[kv[i]] = kv[i+1]
+	if !ok {
+		return []byte("$-1\r\n"), nil
 	}
 
-	aStream.entries = append(aStream.entries, entry)
-	aStream.lastId = validatedId
-	status.databases[status.activeDB].streamStore[key] = aStream
-
-	return encodeRespBulkString(validatedId), nil
+	return encodeRespBulkString(entry.value), nil
 }
 
-func xrange(args []string) ([]byte, error) {
-	if len(args) != 3 {
+func del(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
 		return nil, ErrRespWrongNumberOfArguments
 	}
 
-	key := args[0]
-	start := args[1]
-	end := args[2]
+	keys := args
 
-	stream, ok := status.databases[status.activeDB].streamStore[key]
-	if !ok {
-		return []byte("*0\r\n"), nil
+	deleted := 0
+	for _, key := range keys {
+		if db.keyExists(key) {
+			db.deleteKey(key)
+			deleted++
+		}
 	}
 
-	if start == "-" {
-		start = "0-0"
-	}
+	return encodeRespInteger(deleted), nil
+}
 
-	if end == "+" {
-		end = fmt.Sprintf("%d-%d", math.MaxInt, math.MaxInt)
+func selectFunc(conn *connection, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
 	}
 
-	startMs, startSeq, err := parseStreamEntryId(start)
+	db, err := parseDatabaseIndex(args[0])
 	if err != nil {
 		return nil, err
 	}
 
-	endMs, endSeq, err := parseStreamEntryId(end)
-	if err != nil {
-		return nil, err
-	}
+	conn.db = db.id
 
-	if startSeq == -1 {
-		startSeq = 0
-	}
+	return []byte("+OK\r\n"), nil
+}
 
-	if endSeq == -1 {
-		endSeq = math.MaxInt
+func keys(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
 	}
 
-	capturedEntries := make([]map[string]string, 0)
+	pattern := args[0]
 
-	for _, entry := range stream.entries {
-		entryMs, entrySeq, err := parseStreamEntryId(entry["id"])
-		if err != nil {
-			return nil, err
+	candidates := make([]string, 0)
+	db.forEachKey(func(key string) {
+		if globMatch(pattern, key) {
+			candidates = append(candidates, key)
 		}
+	})
 
-		if (entryMs > startMs || (entryMs == startMs && entrySeq >= startSeq)) &&
-			(entryMs < endMs || (entryMs == endMs && entrySeq <= endSeq)) {
-			capturedEntries = append(capturedEntries, entry)
+	keys := make([]string, 0, len(candidates))
+	for _, key := range candidates {
+		if db.keyExists(key) {
+			keys = append(keys, key)
 		}
-
 	}
 
-	allRespEncodedEntries := make([][]byte, 0)
-	for _, entry := range capturedEntries {
-		respEncodedEntry := streamEntry(entry).encode()
-		allRespEncodedEntries = append(allRespEncodedEntries, respEncodedEntry)
-	}
-
-	response := encodeRespArray(allRespEncodedEntries)
-	return response, nil
+	return encodeRespStringArray(keys), nil
 }
 
-func xread(args []string) ([]byte, error) {
-	var blockTimeout time.Duration
-	var blocking bool = false
-
-	if len(args) < 3 {
+func typeFunc(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
 		return nil, ErrRespWrongNumberOfArguments
 	}
 
-	var streamArgs []string
-
-	for i, arg := range args {
-		if arg == "block" {
-			if i+1 >= len(args) {
-				return nil, ErrRespWrongNumberOfArguments
-			}
-
-			blocking = true
-			timeout, err := strconv.Atoi(args[i+1])
-			if err != nil {
-				return nil, err
-			}
+	key := args[0]
 
-			blockTimeout = time.Duration(timeout) * time.Millisecond
-		}
-		if arg == "streams" {
-			streamArgs = args[i+1:]
-			break
-		}
-	}
+	return encodeRespSimpleString(db.lookupKey(key)), nil
+}
 
-	if len(streamArgs)%2 != 0 {
-		return nil, ErrRespWrongNumberOfArguments
+func parseInteger(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, ErrRespNotInteger
 	}
 
-	allCapturedEntries := make(map[string][]map[string]string)
-	resultC := make(chan xreadRoutineResult)
-	errorC := make(chan error)
-
-	ctx, cancel := context.WithCancel(context.Background())
-
-	for i := 0; i < len(streamArgs)/2; i++ {
-		key := streamArgs[i]
-		id := streamArgs[i+(len(streamArgs)/2)]
+	return n, nil
+}
 
-		go xreadRoutine(ctx, key, id, resultC, errorC, blocking)
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, ErrRespNotFloat
 	}
 
-	for {
-		select {
-		case res := <-resultC:
-			allCapturedEntries[res.key] = res.entries
-			if len(allCapturedEntries) == len(streamArgs)/2 {
-				cancel()
-				// TODO proper sync mechanism
-				// If we try to access a map while the routine is still using it, go will panic
-				// We need to wait until the goroutine is truly finished before going forward
-				time.Sleep(10 * time.Millisecond)
-				return xreadFormatReturn(allCapturedEntries), nil
-			}
-		case <-time.After(blockTimeout):
-			if blocking && blockTimeout > 0 {
-				// TODO proper sync mechanism
-				// If we try to access a map while the routine is still using it, go will panic
-				// We need to wait until the goroutine is truly finished before going forward
-				time.Sleep(10 * time.Millisecond)
-
-				cancel()
-				if len(allCapturedEntries) == 0 {
-					// TODO figure out all the return rules
-					// Apparently if we were blocking for a result,
-					// and there is none we do not return
-					// an empty array, we return the null
-					// bulk string.
-					return []byte("$-1\r\n"), nil
-				}
-				return xreadFormatReturn(allCapturedEntries), nil
-			}
-		}
-	}
+	return f, nil
 }
 
-type xreadRoutineResult struct {
-	key     string
-	entries []map[string]string
+// formatFloat formats floats the way INCRBYFLOAT replies, without exponent
+// nor trailing zeros.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
-func xreadRoutine(ctx context.Context, streamKey string, cutoffId string, resultC chan xreadRoutineResult, errorC chan error, blocking bool) {
-	capturedEntries := make([]map[string]string, 0)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			stream, ok := status.databases[status.activeDB].streamStore[streamKey]
-			if !ok {
-				errorC <- fmt.Errorf("%w no stream for key %s", ErrRespSimpleError, streamKey)
-				return
-			}
-
-			if cutoffId == "$" {
-				cutoffId = stream.lastId
-			}
-
-			cutoffMs, cutoffSeq, err := parseStreamEntryId(cutoffId)
-			if err != nil {
-				errorC <- err
-				return
-			}
-
-			for _, entry := range stream.entries {
-				entryId := entry["id"]
-				entryMs, entrySeq, err := parseStreamEntryId(entryId)
-				if err != nil {
-					errorC <- err
-					return
-				}
-
-				if entryMs > cutoffMs || (entryMs == cutoffMs && entrySeq > cutoffSeq) {
-					capturedEntries = append(capturedEntries, entry)
-				}
-			}
-
-			if blocking && len(capturedEntries) == 0 {
-				continue
-			}
+// normalizeRange converts inclusive `start` and `stop` indexes, where
+// negative values count from the end, into bounds within [0, length).
+// `ok` is false when the resulting range is empty.
+func normalizeRange(start int, stop int, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
 
-			resultC <- xreadRoutineResult{
-				key:     streamKey,
-				entries: capturedEntries,
-			}
-			return
-		}
+	if stop < 0 {
+		stop += length
 	}
-}
 
-func xreadFormatReturn(allCapturedEntries map[string][]map[string]string) []byte {
-	outerArray := make([][]byte, 0)
+	if start < 0 {
+		start = 0
+	}
 
-	for key, entries := range allCapturedEntries {
-		encodedKey := encodeRespBulkString(key)
+	if stop >= length {
+		stop = length - 1
+	}
 
-		allEncodedEntriesForKey := make([][]byte, 0)
-		for _, entry := range entries {
-			encodedEntry := streamEntry(entry).encode()
-			allEncodedEntriesForKey = append(allEncodedEntriesForKey, encodedEntry)
-		}
-		encodedStream := encodeRespArray([][]byte{encodedKey, encodeRespArray(allEncodedEntriesForKey)})
-		outerArray = append(outerArray, encodedStream)
+	if start > stop || start >= length {
+		return 0, 0, false
 	}
 
-	return encodeRespArray(outerArray)
+	return start, stop, true
 }
@@ -0,0 +1,1038 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A stream is an append-only log of entries, each holding field/value pairs
+// and identified by a `<ms>-<seq>` ID greater than the ID of the previous
+// entry. IDs are parsed once, when the entry is added, and compared as
+// numbers from then on.
+
+type streamID struct {
+	ms  int
+	seq int
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+func (id streamID) compare(other streamID) int {
+	return cmp.Or(cmp.Compare(id.ms, other.ms), cmp.Compare(id.seq, other.seq))
+}
+
+// parseStreamID parses a complete `<ms>-<seq>` ID, or `<ms>` alone, the
+// sequence number then defaulting to `defaultSeq`.
+func parseStreamID(s string, defaultSeq int) (streamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+
+	ms, err := strconv.Atoi(msPart)
+	if err != nil || ms < 0 {
+		return streamID{}, ErrRespInvalidStreamID
+	}
+
+	if !hasSeq {
+		return streamID{ms: ms, seq: defaultSeq}, nil
+	}
+
+	seq, err := strconv.Atoi(seqPart)
+	if err != nil || seq < 0 {
+		return streamID{}, ErrRespInvalidStreamID
+	}
+
+	return streamID{ms: ms, seq: seq}, nil
+}
+
+// parseStreamRangeBound parses the start or end of a range of IDs: `-` and
+// `+` for the smallest and greatest IDs, and a `(` prefix for an exclusive
+// bound.
+func parseStreamRangeBound(s string, isStart bool) (streamID, error) {
+	if s == "-" {
+		return streamID{}, nil
+	}
+
+	if s == "+" {
+		return streamID{ms: math.MaxInt, seq: math.MaxInt}, nil
+	}
+
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+
+	defaultSeq := 0
+	if !isStart {
+		defaultSeq = math.MaxInt
+	}
+
+	id, err := parseStreamID(s, defaultSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+
+	if isStart {
+		if id.seq == math.MaxInt {
+			return streamID{ms: id.ms + 1}, nil
+		}
+
+		return streamID{ms: id.ms, seq: id.seq + 1}, nil
+	}
+
+	if id.seq == 0 {
+		return streamID{ms: id.ms - 1, seq: math.MaxInt}, nil
+	}
+
+	return streamID{ms: id.ms, seq: id.seq - 1}, nil
+}
+
+// nextStreamID resolves the ID given to XADD, which must be greater than
+// the last ID of the stream: `*` generates it from the current time, and
+// `<ms>-*` or `<ms>` alone generate its sequence number.
+func nextStreamID(s string, lastID streamID) (streamID, error) {
+	var id streamID
+
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	generateSeq := s == "*" || !hasSeq || seqPart == "*"
+
+	if s == "*" {
+		// Keep IDs increasing if the clock goes backwards
+		id.ms = max(int(time.Now().UnixMilli()), lastID.ms)
+	} else if generateSeq {
+		ms, err := strconv.Atoi(msPart)
+		if err != nil || ms < 0 {
+			return id, ErrRespInvalidStreamID
+		}
+
+		id.ms = ms
+	} else {
+		var err error
+		id, err = parseStreamID(s, 0)
+		if err != nil {
+			return id, err
+		}
+
+		if id == (streamID{}) {
+			return id, ErrRespXAddIDZero
+		}
+	}
+
+	if generateSeq && id.ms == lastID.ms {
+		id.seq = lastID.seq + 1
+	}
+
+	if !lastID.less(id) {
+		return id, ErrRespXAddIDTooSmall
+	}
+
+	return id, nil
+}
+
+// streamEntry holds the fields of an entry in the order they were given.
+type streamEntry struct {
+	id streamID
+	// Field names and values, alternating
+	fields []string
+}
+
+func (entry streamEntry) encode() []byte {
+	return encodeRespArray([][]byte{
+		encodeRespBulkString(entry.id.String()),
+		encodeRespStringArray(entry.fields),
+	})
+}
+
+// A stream keeps its entries in a slice sorted by ID, which is the order
+// they are added in, so that finding an ID or the bounds of a range is a
+// binary search. Trimming evicts the oldest entries by reslicing.
+type stream struct {
+	entries []streamEntry
+	lastID  streamID
+	groups  map[string]*consumerGroup
+	// Number of entries ever added, including deleted and trimmed ones
+	entriesAdded int
+	// Greatest ID deleted with XDEL
+	maxDeletedID streamID
+}
+
+func newStream() stream {
+	return stream{
+		entries: make([]streamEntry, 0),
+		groups:  make(map[string]*consumerGroup),
+	}
+}
+
+// getStream returns the stream stored at key, ok being false if the key does
+// not exist, or ErrRespWrongType if the key holds another data type.
+func getStream(db database, key string) (stream, bool, error) {
+	switch db.lookupKey(key) {
+	case "stream":
+		return db.streamStore[key], true, nil
+	case "none":
+		return stream{}, false, nil
+	}
+
+	return stream{}, false, ErrRespWrongType
+}
+
+// search returns the index of the first entry with an ID of at least `id`.
+func (s stream) search(id streamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].id.less(id)
+	})
+}
+
+// entry returns the entry with the given ID, if it was not deleted.
+func (s stream) entry(id streamID) (streamEntry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].id == id {
+		return s.entries[i], true
+	}
+
+	return streamEntry{}, false
+}
+
+// entriesBetween returns the entries with an ID within [start, end].
+func (s stream) entriesBetween(start streamID, end streamID) []streamEntry {
+	if end.less(start) {
+		return nil
+	}
+
+	from := s.search(start)
+	to := from + sort.Search(len(s.entries)-from, func(i int) bool {
+		return end.less(s.entries[from+i].id)
+	})
+
+	return s.entries[from:to]
+}
+
+// entriesAfter returns the entries with an ID greater than `id`, at most
+// `count` of them unless count is 0.
+func (s stream) entriesAfter(id streamID, count int) []streamEntry {
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return id.less(s.entries[i].id)
+	})
+
+	entries := s.entries[i:]
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+
+	return entries
+}
+
+const (
+	// Entries are evicted by nodes of this many entries when trimming
+	// approximately, like a Redis radix tree node under the default
+	// stream-node-max-entries
+	streamNodeMaxEntries = 100
+	// Default LIMIT of an approximate trim
+	streamTrimDefaultLimit = 100 * streamNodeMaxEntries
+)
+
+// streamTrimOptions holds the MAXLEN | MINID [= | ~] threshold [LIMIT count]
+// options of XADD and XTRIM. An empty strategy means no trimming.
+type streamTrimOptions struct {
+	strategy    string
+	approximate bool
+	maxLen      int
+	minID       streamID
+	// Maximum number of entries evicted by an approximate trim, 0 meaning
+	// no limit
+	limit int
+}
+
+// parseStreamTrimOptions parses trimming options starting at the MAXLEN or
+// MINID argument, and returns how many arguments they span.
+func parseStreamTrimOptions(args []string) (streamTrimOptions, int, error) {
+	options := streamTrimOptions{strategy: strings.ToUpper(args[0])}
+	if options.strategy != "MAXLEN" && options.strategy != "MINID" {
+		return options, 0, ErrRespSyntax
+	}
+
+	i := 1
+	limitSet := false
+
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		options.approximate = args[i] == "~"
+		i++
+	}
+
+	if i >= len(args) {
+		return options, 0, ErrRespSyntax
+	}
+
+	if options.strategy == "MAXLEN" {
+		maxLen, err := parseInteger(args[i])
+		if err != nil {
+			return options, 0, err
+		}
+
+		if maxLen < 0 {
+			return options, 0, ErrRespNegativeMaxLen
+		}
+
+		options.maxLen = maxLen
+	} else {
+		minID, err := parseStreamID(args[i], 0)
+		if err != nil {
+			return options, 0, err
+		}
+
+		options.minID = minID
+	}
+	i++
+
+	if i+1 < len(args) && strings.EqualFold(args[i], "LIMIT") {
+		limit, err := parseInteger(args[i+1])
+		if err != nil {
+			return options, 0, err
+		}
+
+		if limit < 0 {
+			return options, 0, ErrRespNegativeLimit
+		}
+
+		options.limit = limit
+		limitSet = true
+		i += 2
+	}
+
+	if limitSet && !options.approximate {
+		return options, 0, ErrRespLimitWithoutApprox
+	}
+
+	if !limitSet && options.approximate {
+		options.limit = streamTrimDefaultLimit
+	}
+
+	return options, i, nil
+}
+
+// trim evicts the oldest entries according to `options`, and returns how
+// many were evicted. An approximate trim only evicts whole nodes, so it may
+// leave more entries than asked for, but never fewer.
+func (s *stream) trim(options streamTrimOptions) int {
+	n := 0
+	switch options.strategy {
+	case "MAXLEN":
+		n = max(len(s.entries)-options.maxLen, 0)
+	case "MINID":
+		n = s.search(options.minID)
+	}
+
+	if options.approximate {
+		if options.limit > 0 {
+			n = min(n, options.limit)
+		}
+
+		n -= n % streamNodeMaxEntries
+	}
+
+	if n == 0 {
+		return 0
+	}
+
+	// Let the evicted entries be garbage collected
+	clear(s.entries[:n])
+	s.entries = s.entries[n:]
+
+	return n
+}
+
+// delete removes the entries with the given IDs in a single pass over the
+// entries, and returns how many existed. Pending entries referencing them
+// are left in the PELs, where they show up as deleted entries.
+func (s *stream) delete(ids []streamID) int {
+	ids = slices.Clone(ids)
+	slices.SortFunc(ids, streamID.compare)
+	ids = slices.Compact(ids)
+
+	deleted := 0
+	next := 0
+	s.entries = slices.DeleteFunc(s.entries, func(entry streamEntry) bool {
+		for next < len(ids) && ids[next].less(entry.id) {
+			next++
+		}
+
+		if next == len(ids) || ids[next] != entry.id {
+			return false
+		}
+
+		deleted++
+		if s.maxDeletedID.less(entry.id) {
+			s.maxDeletedID = entry.id
+		}
+
+		return true
+	})
+
+	return deleted
+}
+
+// xadd implements XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold
+// [LIMIT count]] id field value [field value ...].
+// The stream is trimmed once the entry is added. It is replicated as an XADD
+// with the generated ID, followed by an exact XTRIM if entries were evicted,
+// so replicas do not have to trim approximately the same way.
+func xadd(db database, args []string) ([]byte, error) {
+	var trim streamTrimOptions
+
+	noMkStream := false
+
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+
+		if option == "NOMKSTREAM" {
+			noMkStream = true
+		} else if option == "MAXLEN" || option == "MINID" {
+			if trim.strategy != "" {
+				return nil, ErrRespMaxLenAndMinID
+			}
+
+			var n int
+			var err error
+			trim, n, err = parseStreamTrimOptions(args[i:])
+			if err != nil {
+				return nil, err
+			}
+
+			i += n - 1
+		} else {
+			break
+		}
+	}
+
+	if i >= len(args) {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	id := args[i]
+	kv := args[i+1:]
+
+	if len(kv) == 0 || len(kv)%2 != 0 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	aStream, ok, err := getStream(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		if noMkStream {
+			return []byte("$-1\r\n"), nil
+		}
+
+		aStream = newStream()
+	}
+
+	entryID, err := nextStreamID(id, aStream.lastID)
+	if err != nil {
+		return nil, err
+	}
+
+	aStream.entries = append(aStream.entries, streamEntry{id: entryID, fields: slices.Clone(kv)})
+	aStream.lastID = entryID
+	aStream.entriesAdded++
+	evicted := aStream.trim(trim)
+	db.streamStore[key] = aStream
+	db.keys.insert(key)
+	signalKeyAsReady(db, key)
+
+	// Replicas must store the entry under the ID generated here
+	propagate(db, append([]string{"XADD", key, entryID.String()}, kv...)...)
+	if evicted > 0 {
+		propagate(db, "XTRIM", key, "MAXLEN", "=", strconv.Itoa(len(aStream.entries)))
+	}
+
+	return encodeRespBulkString(entryID.String()), nil
+}
+
+// xtrim implements XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count].
+// Like XADD, it is replicated as an exact trim.
+func xtrim(db database, args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	trim, n, err := parseStreamTrimOptions(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if n != len(args)-1 {
+		return nil, ErrRespSyntax
+	}
+
+	aStream, ok, err := getStream(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return encodeRespInteger(0), nil
+	}
+
+	evicted := aStream.trim(trim)
+	db.streamStore[key] = aStream
+
+	if evicted > 0 {
+		propagate(db, "XTRIM", key, "MAXLEN", "=", strconv.Itoa(len(aStream.entries)))
+	}
+
+	return encodeRespInteger(evicted), nil
+}
+
+// xdel deletes entries by ID. The stream keeps track of the greatest deleted
+// ID, which XINFO reports.
+func xdel(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	ids := make([]streamID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	aStream, ok, err := getStream(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return encodeRespInteger(0), nil
+	}
+
+	deleted := aStream.delete(ids)
+	db.streamStore[key] = aStream
+
+	return encodeRespInteger(deleted), nil
+}
+
+func xlen(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	aStream, _, err := getStream(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRespInteger(len(aStream.entries)), nil
+}
+
+const xinfoFullDefaultCount = 10
+
+// xinfo implements XINFO STREAM key [FULL [COUNT count]], XINFO GROUPS key
+// and XINFO CONSUMERS key group.
+func xinfo(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	subcommand := strings.ToUpper(args[0])
+
+	switch subcommand {
+	case "STREAM":
+		return xinfoStream(db, args[1:])
+	case "GROUPS":
+		return xinfoGroups(db, args[1:])
+	case "CONSUMERS":
+		return xinfoConsumers(db, args[1:])
+	}
+
+	return nil, errUnknownSubcommand(subcommand, "XINFO")
+}
+
+// getExistingStream returns the stream at key, or an error if there is none.
+func getExistingStream(db database, key string) (stream, error) {
+	s, ok, err := getStream(db, key)
+	if err != nil {
+		return s, err
+	}
+
+	if !ok {
+		return s, ErrRespNoSuchKey
+	}
+
+	return s, nil
+}
+
+// xinfoStream replies the length, IDs and counters of a stream, along with
+// its first and last entries and how many groups it has. With FULL, it
+// replies the first COUNT entries instead, and the details of every group,
+// their pending entries and consumers, COUNT 0 meaning everything.
+func xinfoStream(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	full := false
+	count := xinfoFullDefaultCount
+
+	if len(args) > 1 {
+		if !strings.EqualFold(args[1], "FULL") || (len(args) != 2 && len(args) != 4) {
+			return nil, ErrRespSyntax
+		}
+
+		full = true
+
+		if len(args) == 4 {
+			if !strings.EqualFold(args[2], "COUNT") {
+				return nil, ErrRespSyntax
+			}
+
+			n, err := parseInteger(args[3])
+			if err != nil {
+				return nil, err
+			}
+
+			count = max(n, 0)
+		}
+	}
+
+	s, err := getExistingStream(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	firstID := streamID{}
+	if len(s.entries) > 0 {
+		firstID = s.entries[0].id
+	}
+
+	reply := [][]byte{
+		encodeRespBulkString("length"),
+		encodeRespInteger(len(s.entries)),
+		encodeRespBulkString("last-generated-id"),
+		encodeRespBulkString(s.lastID.String()),
+		encodeRespBulkString("max-deleted-entry-id"),
+		encodeRespBulkString(s.maxDeletedID.String()),
+		encodeRespBulkString("entries-added"),
+		encodeRespInteger(s.entriesAdded),
+		encodeRespBulkString("recorded-first-entry-id"),
+		encodeRespBulkString(firstID.String()),
+	}
+
+	if !full {
+		firstEntry := []byte("$-1\r\n")
+		lastEntry := []byte("$-1\r\n")
+		if len(s.entries) > 0 {
+			firstEntry = s.entries[0].encode()
+			lastEntry = s.entries[len(s.entries)-1].encode()
+		}
+
+		reply = append(reply,
+			encodeRespBulkString("groups"),
+			encodeRespInteger(len(s.groups)),
+			encodeRespBulkString("first-entry"),
+			firstEntry,
+			encodeRespBulkString("last-entry"),
+			lastEntry,
+		)
+
+		return encodeRespArray(reply), nil
+	}
+
+	entries := s.entries
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+
+	groups := make([][]byte, 0, len(s.groups))
+	for _, name := range sortedGroupNames(s) {
+		groups = append(groups, encodeGroupFull(s, name, count))
+	}
+
+	reply = append(reply,
+		encodeRespBulkString("entries"),
+		encodeRespArray(encodeStreamEntries(entries)),
+		encodeRespBulkString("groups"),
+		encodeRespArray(groups),
+	)
+
+	return encodeRespArray(reply), nil
+}
+
+func xinfoGroups(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	s, err := getExistingStream(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([][]byte, 0, len(s.groups))
+	for _, name := range sortedGroupNames(s) {
+		g := s.groups[name]
+
+		groups = append(groups, encodeRespArray([][]byte{
+			encodeRespBulkString("name"),
+			encodeRespBulkString(name),
+			encodeRespBulkString("consumers"),
+			encodeRespInteger(len(g.consumers)),
+			encodeRespBulkString("pending"),
+			encodeRespInteger(len(g.pending)),
+			encodeRespBulkString("last-delivered-id"),
+			encodeRespBulkString(g.lastDeliveredID.String()),
+			encodeRespBulkString("entries-read"),
+			encodeEntriesRead(g),
+			encodeRespBulkString("lag"),
+			encodeLag(s, g),
+		}))
+	}
+
+	return encodeRespArray(groups), nil
+}
+
+// xinfoConsumers replies the consumers of a group, with the time since they
+// last tried to read or claim entries, and since they last did, -1 if they
+// never did.
+func xinfoConsumers(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	if _, err := getExistingStream(db, args[0]); err != nil {
+		return nil, err
+	}
+
+	_, g, err := getConsumerGroup(db, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	consumers := make([][]byte, 0, len(g.consumers))
+	for _, c := range sortedConsumers(g) {
+		inactive := -1
+		if !c.activeAt.IsZero() {
+			inactive = int(now.Sub(c.activeAt).Milliseconds())
+		}
+
+		consumers = append(consumers, encodeRespArray([][]byte{
+			encodeRespBulkString("name"),
+			encodeRespBulkString(c.name),
+			encodeRespBulkString("pending"),
+			encodeRespInteger(len(c.pending)),
+			encodeRespBulkString("idle"),
+			encodeRespInteger(int(now.Sub(c.seenAt).Milliseconds())),
+			encodeRespBulkString("inactive"),
+			encodeRespInteger(inactive),
+		}))
+	}
+
+	return encodeRespArray(consumers), nil
+}
+
+// encodeGroupFull encodes a group for XINFO STREAM FULL, with up to `count`
+// pending entries for the group and for each consumer, 0 meaning all of
+// them.
+func encodeGroupFull(s stream, name string, count int) []byte {
+	g := s.groups[name]
+
+	pending := make([][]byte, 0)
+	for _, pe := range sortedPendingEntries(g.pending) {
+		if count > 0 && len(pending) == count {
+			break
+		}
+
+		pending = append(pending, encodeRespArray([][]byte{
+			encodeRespBulkString(pe.id.String()),
+			encodeRespBulkString(pe.consumer.name),
+			encodeRespInteger(int(pe.deliveredAt.UnixMilli())),
+			encodeRespInteger(pe.deliveryCount),
+		}))
+	}
+
+	consumers := make([][]byte, 0, len(g.consumers))
+	for _, c := range sortedConsumers(g) {
+		activeTime := -1
+		if !c.activeAt.IsZero() {
+			activeTime = int(c.activeAt.UnixMilli())
+		}
+
+		consumerPending := make([][]byte, 0)
+		for _, pe := range sortedPendingEntries(c.pending) {
+			if count > 0 && len(consumerPending) == count {
+				break
+			}
+
+			consumerPending = append(consumerPending, encodeRespArray([][]byte{
+				encodeRespBulkString(pe.id.String()),
+				encodeRespInteger(int(pe.deliveredAt.UnixMilli())),
+				encodeRespInteger(pe.deliveryCount),
+			}))
+		}
+
+		consumers = append(consumers, encodeRespArray([][]byte{
+			encodeRespBulkString("name"),
+			encodeRespBulkString(c.name),
+			encodeRespBulkString("seen-time"),
+			encodeRespInteger(int(c.seenAt.UnixMilli())),
+			encodeRespBulkString("active-time"),
+			encodeRespInteger(activeTime),
+			encodeRespBulkString("pel-count"),
+			encodeRespInteger(len(c.pending)),
+			encodeRespBulkString("pending"),
+			encodeRespArray(consumerPending),
+		}))
+	}
+
+	return encodeRespArray([][]byte{
+		encodeRespBulkString("name"),
+		encodeRespBulkString(name),
+		encodeRespBulkString("last-delivered-id"),
+		encodeRespBulkString(g.lastDeliveredID.String()),
+		encodeRespBulkString("entries-read"),
+		encodeEntriesRead(g),
+		encodeRespBulkString("lag"),
+		encodeLag(s, g),
+		encodeRespBulkString("pel-count"),
+		encodeRespInteger(len(g.pending)),
+		encodeRespBulkString("pending"),
+		encodeRespArray(pending),
+		encodeRespBulkString("consumers"),
+		encodeRespArray(consumers),
+	})
+}
+
+func encodeEntriesRead(g *consumerGroup) []byte {
+	if g.entriesRead == streamInvalidEntriesRead {
+		return []byte("$-1\r\n")
+	}
+
+	return encodeRespInteger(g.entriesRead)
+}
+
+func encodeLag(s stream, g *consumerGroup) []byte {
+	lag, ok := g.lag(s)
+	if !ok {
+		return []byte("$-1\r\n")
+	}
+
+	return encodeRespInteger(lag)
+}
+
+// xrange implements XRANGE key start end [COUNT count], and XREVRANGE key
+// end start [COUNT count] when `rev` is set, which replies the entries from
+// the newest to the oldest.
+func xrange(db database, args []string, rev bool) ([]byte, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+
+	count := -1
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "COUNT") {
+			return nil, ErrRespSyntax
+		}
+
+		n, err := parseInteger(args[4])
+		if err != nil {
+			return nil, err
+		}
+
+		count = max(n, 0)
+	}
+
+	start, err := parseStreamRangeBound(startArg, true)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseStreamRangeBound(endArg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, ok, err := getStream(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok || count == 0 {
+		return []byte("*0\r\n"), nil
+	}
+
+	entries := stream.entriesBetween(start, end)
+	if rev {
+		entries = slices.Clone(entries)
+		slices.Reverse(entries)
+	}
+
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+
+	return encodeRespArray(encodeStreamEntries(entries)), nil
+}
+
+// xread implements XREAD [COUNT count] [BLOCK milliseconds] STREAMS key
+// [key ...] id [id ...], replying the entries with an ID greater than the
+// given one, with streams in the order of the arguments. A key given several
+// times is read once per ID. The `$` ID reads only entries added after the
+// call. With BLOCK, it waits until an entry is added to one of the streams,
+// and replies that stream alone.
+func xread(db database, args []string, mayBlock bool) ([]byte, error) {
+	var streamArgs []string
+	var timeout time.Duration
+	count := 0
+	blocking := false
+
+	for i := 0; i < len(args) && streamArgs == nil; i++ {
+		option := strings.ToUpper(args[i])
+
+		switch {
+		case option == "COUNT" && i+1 < len(args):
+			n, err := parseInteger(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			count = max(n, 0)
+			i++
+		case option == "BLOCK" && i+1 < len(args):
+			ms, err := parseInteger(args[i+1])
+			if err != nil {
+				return nil, ErrRespTimeoutNotInteger
+			}
+
+			if ms < 0 {
+				return nil, ErrRespTimeoutNegative
+			}
+
+			blocking = true
+			timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case option == "STREAMS":
+			streamArgs = args[i+1:]
+		default:
+			return nil, ErrRespSyntax
+		}
+	}
+
+	if len(streamArgs) == 0 || len(streamArgs)%2 != 0 {
+		return nil, errUnbalancedStreams("xread")
+	}
+
+	keys := streamArgs[:len(streamArgs)/2]
+	ids := make([]streamID, len(keys))
+	replies := make([][]byte, 0, len(keys))
+
+	for i, key := range keys {
+		s, ok, err := getStream(db, key)
+		if err != nil {
+			return nil, err
+		}
+
+		id := streamArgs[len(keys)+i]
+		if id == "$" {
+			ids[i] = s.lastID
+			continue
+		}
+
+		ids[i], err = parseStreamID(id, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if entries := s.entriesAfter(ids[i], count); len(entries) > 0 {
+			replies = append(replies, encodeStreamReply(key, encodeStreamEntries(entries)))
+		}
+	}
+
+	if len(replies) > 0 {
+		return encodeRespArray(replies), nil
+	}
+
+	if !blocking || !mayBlock {
+		return []byte("*-1\r\n"), nil
+	}
+
+	serve := func(db database, key string) ([]byte, bool) {
+		s, ok, err := getStream(db, key)
+		if err != nil || !ok {
+			return nil, false
+		}
+
+		replies := make([][]byte, 0, 1)
+		for i := range keys {
+			if keys[i] != key {
+				continue
+			}
+
+			if entries := s.entriesAfter(ids[i], count); len(entries) > 0 {
+				replies = append(replies, encodeStreamReply(key, encodeStreamEntries(entries)))
+			}
+		}
+
+		if len(replies) == 0 {
+			return nil, false
+		}
+
+		return encodeRespArray(replies), true
+	}
+
+	reply := blockForKeys(db, keys, timeout, serve)
+	if reply == nil {
+		return []byte("*-1\r\n"), nil
+	}
+
+	return reply, nil
+}
+
+// encodeStreamReply encodes the already encoded entries read from a stream
+// by XREAD or XREADGROUP, along with the key of the stream.
+func encodeStreamReply(key string, entries [][]byte) []byte {
+	return encodeRespArray([][]byte{encodeRespBulkString(key), encodeRespArray(entries)})
+}
+
+func encodeStreamEntries(entries []streamEntry) [][]byte {
+	encoded := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		encoded = append(encoded, entry.encode())
+	}
+
+	return encoded
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStreamTrimming(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		evicted int
+		wantErr error
+	}{
+		{name: "exact maxlen", args: []string{"MAXLEN", "150"}, evicted: 100},
+		{name: "exact maxlen with =", args: []string{"MAXLEN", "=", "249"}, evicted: 1},
+		{name: "approximate maxlen evicts whole nodes", args: []string{"MAXLEN", "~", "49"}, evicted: 200},
+		{name: "approximate maxlen with limit", args: []string{"MAXLEN", "~", "0", "LIMIT", "150"}, evicted: 100},
+		{name: "approximate maxlen without limit", args: []string{"MAXLEN", "~", "0", "LIMIT", "0"}, evicted: 200},
+		{name: "exact minid", args: []string{"MINID", "11"}, evicted: 10},
+		{name: "approximate minid", args: []string{"MINID", "~", "111"}, evicted: 100},
+		{name: "limit without ~", args: []string{"MAXLEN", "0", "LIMIT", "10"}, wantErr: ErrRespLimitWithoutApprox},
+		{name: "negative maxlen", args: []string{"MAXLEN", "-1"}, wantErr: ErrRespNegativeMaxLen},
+		{name: "trailing argument", args: []string{"MAXLEN", "1", "2"}, wantErr: ErrRespSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestStore()
+			for i := 1; i <= 250; i++ {
+				xadd(db, []string{"s", fmt.Sprintf("%d-1", i), "field", "value"})
+			}
+
+			got, err := xtrim(db, append([]string{"s"}, tt.args...))
+			if err != tt.wantErr {
+				t.Fatalf("xtrim error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if string(got) != string(encodeRespInteger(tt.evicted)) {
+				t.Errorf("xtrim = %q, want %d", got, tt.evicted)
+			}
+
+			s := db.streamStore["s"]
+			if len(s.entries) != 250-tt.evicted || s.entriesAdded != 250 {
+				t.Errorf("length = %d, entries added = %d, want %d, 250", len(s.entries), s.entriesAdded, 250-tt.evicted)
+			}
+		})
+	}
+}
+
+func TestXAddOptionsAndXDel(t *testing.T) {
+	db := setupTestStore()
+
+	got, _ := xadd(db, []string{"s", "NOMKSTREAM", "1-1", "field", "value"})
+	if string(got) != "$-1\r\n" || db.keyExists("s") {
+		t.Fatalf("xadd NOMKSTREAM on a missing key = %q, want a null reply", got)
+	}
+
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		xadd(db, []string{"s", "MAXLEN", "2", id, "field", "value"})
+	}
+
+	if _, err := xadd(db, []string{"s", "MAXLEN", "1", "MINID", "1", "*", "field", "value"}); err != ErrRespMaxLenAndMinID {
+		t.Errorf("xadd with MAXLEN and MINID error = %v, want %v", err, ErrRespMaxLenAndMinID)
+	}
+
+	got, _ = xlen(db, []string{"s"})
+	if string(got) != string(encodeRespInteger(2)) {
+		t.Errorf("xlen = %q, want 2", got)
+	}
+
+	got, _ = xdel(db, []string{"s", "3-1", "1-1", "3-1"})
+	if string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("xdel = %q, want 1", got)
+	}
+
+	s := db.streamStore["s"]
+	if len(s.entries) != 1 || s.entries[0].id != (streamID{ms: 2, seq: 1}) {
+		t.Errorf("entries left = %v, want 2-1", s.entries)
+	}
+
+	if s.maxDeletedID != (streamID{ms: 3, seq: 1}) || s.lastID != (streamID{ms: 3, seq: 1}) || s.entriesAdded != 3 {
+		t.Errorf("max deleted ID = %v, last ID = %v, entries added = %d, want 3-1, 3-1, 3", s.maxDeletedID, s.lastID, s.entriesAdded)
+	}
+}
+
+func TestXRangeAndXRevRange(t *testing.T) {
+	db := setupTestStore()
+	for _, id := range []string{"1-1", "2-1", "3-1", "4-1"} {
+		xadd(db, []string{"s", id, "field", "value"})
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		rev    bool
+		wantMs []int
+	}{
+		{name: "whole stream", args: []string{"s", "-", "+"}, wantMs: []int{1, 2, 3, 4}},
+		{name: "count", args: []string{"s", "2", "+", "COUNT", "2"}, wantMs: []int{2, 3}},
+		{name: "exclusive bounds", args: []string{"s", "(1-1", "(4-1"}, wantMs: []int{2, 3}},
+		{name: "reversed", args: []string{"s", "+", "-"}, rev: true, wantMs: []int{4, 3, 2, 1}},
+		{name: "reversed with count", args: []string{"s", "3", "-", "COUNT", "2"}, rev: true, wantMs: []int{3, 2}},
+		{name: "zero count", args: []string{"s", "-", "+", "COUNT", "0"}, wantMs: []int{}},
+		{name: "missing key", args: []string{"missing", "-", "+"}, wantMs: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xrange(db, tt.args, tt.rev)
+			if err != nil {
+				t.Fatalf("xrange error = %v", err)
+			}
+
+			entries := make([]streamEntry, 0, len(tt.wantMs))
+			for _, ms := range tt.wantMs {
+				entries = append(entries, streamEntry{id: streamID{ms: ms, seq: 1}, fields: []string{"field", "value"}})
+			}
+
+			want := encodeRespArray(encodeStreamEntries(entries))
+			if string(got) != string(want) {
+				t.Errorf("xrange = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestNextStreamID(t *testing.T) {
+	tests := []struct {
+		id      string
+		lastID  streamID
+		want    streamID
+		wantErr error
+	}{
+		{id: "5-3", lastID: streamID{ms: 5, seq: 2}, want: streamID{ms: 5, seq: 3}},
+		{id: "5-*", lastID: streamID{ms: 5, seq: 2}, want: streamID{ms: 5, seq: 3}},
+		{id: "6-*", lastID: streamID{ms: 5, seq: 2}, want: streamID{ms: 6, seq: 0}},
+		{id: "0-*", lastID: streamID{}, want: streamID{ms: 0, seq: 1}},
+		{id: "7", lastID: streamID{ms: 7, seq: 1}, want: streamID{ms: 7, seq: 2}},
+		{id: "0-0", lastID: streamID{}, wantErr: ErrRespXAddIDZero},
+		{id: "5-2", lastID: streamID{ms: 5, seq: 2}, wantErr: ErrRespXAddIDTooSmall},
+		{id: "4-*", lastID: streamID{ms: 5, seq: 2}, wantErr: ErrRespXAddIDTooSmall},
+		{id: "a-1", lastID: streamID{}, wantErr: ErrRespInvalidStreamID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := nextStreamID(tt.id, tt.lastID)
+			if err != tt.wantErr {
+				t.Fatalf("nextStreamID error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && got != tt.want {
+				t.Errorf("nextStreamID = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A generated ID stays greater than the last one when the clock is behind
+	future := streamID{ms: math.MaxInt - 1, seq: 4}
+	if got, _ := nextStreamID("*", future); got != (streamID{ms: future.ms, seq: 5}) {
+		t.Errorf("nextStreamID(*) after %v = %v", future, got)
+	}
+}
+
+func TestStreamEntriesKeepFieldOrder(t *testing.T) {
+	db := setupTestStore()
+	xadd(db, []string{"s", "1-1", "zebra", "1", "id", "2", "apple", "3", "zebra", "4"})
+
+	got, _ := xrange(db, []string{"s", "-", "+"}, false)
+	want := "*1\r\n*2\r\n$3\r\n1-1\r\n*8\r\n" +
+		"$5\r\nzebra\r\n$1\r\n1\r\n$2\r\nid\r\n$1\r\n2\r\n$5\r\napple\r\n$1\r\n3\r\n$5\r\nzebra\r\n$1\r\n4\r\n"
+	if string(got) != want {
+		t.Errorf("xrange = %q, want %q", got, want)
+	}
+}
+
+func TestXReadRepliesStreamsInArgumentOrder(t *testing.T) {
+	db := setupTestStore()
+	for _, key := range []string{"c", "a", "b"} {
+		xadd(db, []string{key, "1-1", "field", key})
+	}
+
+	for i := 0; i < 10; i++ {
+		got, err := xread(db, []string{"COUNT", "1", "STREAMS", "b", "missing", "c", "a", "0", "0", "0", "0"}, false)
+		if err != nil {
+			t.Fatalf("xread error = %v", err)
+		}
+
+		replies := make([][]byte, 0)
+		for _, key := range []string{"b", "c", "a"} {
+			entry := streamEntry{id: streamID{ms: 1, seq: 1}, fields: []string{"field", key}}
+			replies = append(replies, encodeStreamReply(key, [][]byte{entry.encode()}))
+		}
+
+		if want := encodeRespArray(replies); string(got) != string(want) {
+			t.Fatalf("xread = %q, want %q", got, want)
+		}
+	}
+
+	got, _ := xread(db, []string{"STREAMS", "a", "b", "$", "1-1"}, false)
+	if string(got) != "*-1\r\n" {
+		t.Errorf("xread without new entries = %q, want a null reply", got)
+	}
+}
+
+func TestXReadKeepsTheIDOfEachArgument(t *testing.T) {
+	db := setupTestStore()
+	for _, id := range []string{"1-1", "2-1", "6-1"} {
+		xadd(db, []string{"k", id, "field", id})
+	}
+
+	encode := func(ids ...string) []byte {
+		entries := make([][]byte, 0, len(ids))
+		for _, id := range ids {
+			parsed, _ := parseStreamID(id, 0)
+			entries = append(entries, streamEntry{id: parsed, fields: []string{"field", id}}.encode())
+		}
+
+		return encodeStreamReply("k", entries)
+	}
+
+	got, err := xread(db, []string{"STREAMS", "k", "k", "0", "5"}, false)
+	if err != nil {
+		t.Fatalf("xread error = %v", err)
+	}
+
+	if want := encodeRespArray([][]byte{encode("1-1", "2-1", "6-1"), encode("6-1")}); string(got) != string(want) {
+		t.Errorf("xread of a key given twice = %q, want %q", got, want)
+	}
+
+	got, _ = xread(db, []string{"STREAMS", "k", "k", "6-1", "1-1"}, false)
+	if want := encodeRespArray([][]byte{encode("2-1", "6-1")}); string(got) != string(want) {
+		t.Errorf("xread of a key given twice, once without new entries = %q, want %q", got, want)
+	}
+}
+
+func TestBlockingXReadIsServedByXAdd(t *testing.T) {
+	db := setupTestStore()
+	xadd(db, []string{"s", "1-1", "field", "old"})
+
+	replyC := make(chan []byte)
+	go func() {
+		reply, _ := runLocked(func() ([]byte, error) {
+			return xread(db, []string{"BLOCK", "0", "STREAMS", "other", "s", "$", "$"}, true)
+		})
+		replyC <- reply
+	}()
+
+	waitForBlockedClients(t, "s", 1)
+
+	// A key of another type is signaled without serving the client
+	runLocked(func() ([]byte, error) {
+		return lpush(db, []string{"other", "value"})
+	})
+
+	runLocked(func() ([]byte, error) {
+		return xadd(db, []string{"s", "2-1", "field", "new"})
+	})
+
+	select {
+	case reply := <-replyC:
+		entry := streamEntry{id: streamID{ms: 2, seq: 1}, fields: []string{"field", "new"}}
+		want := encodeRespArray([][]byte{encodeStreamReply("s", [][]byte{entry.encode()})})
+		if string(reply) != string(want) {
+			t.Errorf("xread = %q, want %q", reply, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("xread was not served by xadd")
+	}
+
+	waitForBlockedClients(t, "other", 0)
+}
+
+func TestBlockingXReadTimeout(t *testing.T) {
+	db := setupTestStore()
+
+	got, _ := runLocked(func() ([]byte, error) {
+		return xread(db, []string{"BLOCK", "10", "STREAMS", "s", "$"}, true)
+	})
+	if string(got) != "*-1\r\n" {
+		t.Errorf("xread after timeout = %q, want a null reply", got)
+	}
+
+	waitForBlockedClients(t, "s", 0)
+}
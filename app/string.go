@@ -0,0 +1,587 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Strings cannot grow past Redis's default proto-max-bulk-len
+const maxStringLength = 512 * 1024 * 1024
+
+// getString returns the string stored at key, ok being false if the key does
+// not exist, or ErrRespWrongType if the key holds another data type.
+func getString(db database, key string) (stringEntry, bool, error) {
+	switch db.lookupKey(key) {
+	case "string":
+		return db.stringStore[key], true, nil
+	case "none":
+		return stringEntry{}, false, nil
+	}
+
+	return stringEntry{}, false, ErrRespWrongType
+}
+
+func appendFunc(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	entry, _, err := getString(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entry.value)+len(args[1]) > maxStringLength {
+		return nil, ErrRespStringTooLong
+	}
+
+	entry.value += args[1]
+	db.setString(key, entry)
+
+	return encodeRespInteger(len(entry.value)), nil
+}
+
+func strlen(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	entry, _, err := getString(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRespInteger(len(entry.value)), nil
+}
+
+// getrange follows Redis's clamping rules, which differ from list ranges:
+// an end before the start of the string is clamped to the first byte.
+func getrange(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	start, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseInteger(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	entry, _, err := getString(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	length := len(entry.value)
+
+	if start < 0 && end < 0 && start > end {
+		return encodeRespBulkString(""), nil
+	}
+
+	if start < 0 {
+		start += length
+	}
+
+	if end < 0 {
+		end += length
+	}
+
+	start = max(start, 0)
+	end = max(end, 0)
+	end = min(end, length-1)
+
+	if start > end || length == 0 {
+		return encodeRespBulkString(""), nil
+	}
+
+	return encodeRespBulkString(entry.value[start : end+1]), nil
+}
+
+// setrange pads the string with zero bytes when `offset` is past its end.
+func setrange(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	value := args[2]
+
+	offset, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if offset < 0 {
+		return nil, ErrRespOffsetOutOfRange
+	}
+
+	entry, ok, err := getString(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) == 0 {
+		return encodeRespInteger(len(entry.value)), nil
+	}
+
+	if offset+len(value) > maxStringLength {
+		return nil, ErrRespStringTooLong
+	}
+
+	current := entry.value
+	if !ok {
+		current = ""
+	}
+
+	if len(current) < offset {
+		current += strings.Repeat("\x00", offset-len(current))
+	}
+
+	if offset+len(value) < len(current) {
+		entry.value = current[:offset] + value + current[offset+len(value):]
+	} else {
+		entry.value = current[:offset] + value
+	}
+
+	db.setString(key, entry)
+
+	return encodeRespInteger(len(entry.value)), nil
+}
+
+func getdel(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	entry, ok, err := getString(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return []byte("$-1\r\n"), nil
+	}
+
+	db.deleteKey(key)
+
+	return encodeRespBulkString(entry.value), nil
+}
+
+// getex is replicated as a PEXPIREAT or a PERSIST, and as a DEL when the
+// expiry is in the past.
+func getex(db database, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	options := args[1:]
+	now := time.Now()
+
+	var expiresAt *time.Time
+	persist := false
+
+	if len(options) == 1 && strings.EqualFold(options[0], "PERSIST") {
+		persist = true
+	} else if len(options) == 2 {
+		unit, absolute, ok := parseExpiryOption(options[0])
+		if !ok {
+			return nil, ErrRespSyntax
+		}
+
+		expiry, err := parseInteger(options[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if expiry <= 0 {
+			return nil, errInvalidExpireTime("getex")
+		}
+
+		t, err := expiryTime(expiry, unit, absolute, now)
+		if err != nil {
+			return nil, errInvalidExpireTime("getex")
+		}
+
+		expiresAt = &t
+	} else if len(options) != 0 {
+		return nil, ErrRespSyntax
+	}
+
+	entry, ok, err := getString(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return []byte("$-1\r\n"), nil
+	}
+
+	if expiresAt != nil {
+		setExpiry(db, key, *expiresAt, now)
+	} else if _, ok := db.expires[key]; ok && persist {
+		delete(db.expires, key)
+		propagate(db, "PERSIST", key)
+	}
+
+	return encodeRespBulkString(entry.value), nil
+}
+
+// incrBy adds `delta` to the integer stored at key, keeping its TTL.
+func incrBy(db database, key string, delta int) ([]byte, error) {
+	entry, ok, err := getString(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	current := 0
+	if ok {
+		current, err = parseInteger(entry.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return nil, ErrRespIncrementOverflow
+	}
+
+	entry.value = strconv.Itoa(current + delta)
+	db.setString(key, entry)
+
+	return encodeRespInteger(current + delta), nil
+}
+
+func incr(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	return incrBy(db, args[0], 1)
+}
+
+func decr(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	return incrBy(db, args[0], -1)
+}
+
+func incrby(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	increment, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return incrBy(db, args[0], increment)
+}
+
+func decrby(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	decrement, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// The decrement cannot be negated
+	if decrement == math.MinInt64 {
+		return nil, ErrRespDecrementOverflow
+	}
+
+	return incrBy(db, args[0], -decrement)
+}
+
+// incrbyfloat keeps the TTL of the key. Like hincrbyfloat, it is replicated
+// as a SET of the resulting value so that replicas never compute floats.
+func incrbyfloat(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	increment, err := parseFloat(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if math.IsInf(increment, 0) {
+		return nil, ErrRespIncrementNaNOrInfinity
+	}
+
+	entry, ok, err := getString(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	current := 0.0
+	if ok {
+		current, err = parseFloat(entry.value)
+		if err != nil || math.IsInf(current, 0) {
+			return nil, ErrRespNotFloat
+		}
+	}
+
+	result := current + increment
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, ErrRespIncrementNaNOrInfinity
+	}
+
+	entry.value = formatFloat(result)
+	db.setString(key, entry)
+	propagate(db, "SET", key, entry.value, "KEEPTTL")
+
+	return encodeRespBulkString(entry.value), nil
+}
+
+// mset sets every key at once, as commands run one at a time while holding
+// the store lock.
+func mset(db database, args []string) ([]byte, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		db.deleteKey(args[i])
+		db.setString(args[i], stringEntry{value: args[i+1]})
+	}
+
+	return []byte("+OK\r\n"), nil
+}
+
+// msetnx sets none of the keys if any of them already exists.
+func msetnx(db database, args []string) ([]byte, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		_, ok, err := getString(db, args[i])
+		if ok || err != nil {
+			return encodeRespInteger(0), nil
+		}
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		db.setString(args[i], stringEntry{value: args[i+1]})
+	}
+
+	return encodeRespInteger(1), nil
+}
+
+// mget replies with a null for keys that do not hold a string.
+func mget(db database, args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	values := make([][]byte, 0, len(args))
+	for _, key := range args {
+		entry, ok, err := getString(db, key)
+		if !ok || err != nil {
+			values = append(values, []byte("$-1\r\n"))
+		} else {
+			values = append(values, encodeRespBulkString(entry.value))
+		}
+	}
+
+	return encodeRespArray(values), nil
+}
+
+// getset sets a new value and returns the old one, discarding any TTL like
+// SET does.
+func getset(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	entry, ok, err := getString(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	db.setString(key, stringEntry{value: args[1]})
+	delete(db.expires, key)
+
+	if !ok {
+		return []byte("$-1\r\n"), nil
+	}
+
+	return encodeRespBulkString(entry.value), nil
+}
+
+// lcs computes the longest common subsequence of two strings with the
+// classic dynamic programming table, then walks it back from the end to
+// rebuild the subsequence and the matching ranges. Ranges are therefore
+// reported from the last one to the first one, like Redis does.
+func lcs(db database, args []string) ([]byte, error) {
+	var getLen, getIdx, withMatchLen bool
+	minMatchLen := 0
+
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	options := args[2:]
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(options) {
+				return nil, ErrRespSyntax
+			}
+
+			var err error
+
+			minMatchLen, err = parseInteger(options[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			minMatchLen = max(minMatchLen, 0)
+			i++
+		default:
+			return nil, ErrRespSyntax
+		}
+	}
+
+	if getLen && getIdx {
+		return nil, ErrRespLCSLenAndIdx
+	}
+
+	a, _, err := getString(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	b, _, err := getString(db, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	table := lcsTable(a.value, b.value)
+	lcsLength := table[len(a.value)][len(b.value)]
+
+	if getLen {
+		return encodeRespInteger(lcsLength), nil
+	}
+
+	result := make([]byte, lcsLength)
+	matches := make([][]byte, 0)
+	idx := lcsLength
+
+	aStart, aEnd, bStart, bEnd := -1, -1, -1, -1
+	i, j := len(a.value), len(b.value)
+
+	for i > 0 && j > 0 {
+		emitRange := false
+
+		if a.value[i-1] == b.value[j-1] {
+			result[idx-1] = a.value[i-1]
+
+			if aStart == -1 {
+				aStart, aEnd = i-1, i-1
+				bStart, bEnd = j-1, j-1
+			} else {
+				// Walking back along the diagonal extends the current range
+				aStart--
+				bStart--
+			}
+
+			// The loop ends once either string is exhausted
+			if aStart == 0 || bStart == 0 {
+				emitRange = true
+			}
+
+			idx--
+			i--
+			j--
+		} else {
+			if table[i-1][j] > table[i][j-1] {
+				i--
+			} else {
+				j--
+			}
+
+			if aStart != -1 {
+				emitRange = true
+			}
+		}
+
+		if emitRange {
+			matchLen := aEnd - aStart + 1
+
+			if minMatchLen == 0 || matchLen >= minMatchLen {
+				match := [][]byte{
+					encodeRespIntegerArray([]int{aStart, aEnd}),
+					encodeRespIntegerArray([]int{bStart, bEnd}),
+				}
+
+				if withMatchLen {
+					match = append(match, encodeRespInteger(matchLen))
+				}
+
+				matches = append(matches, encodeRespArray(match))
+			}
+
+			aStart = -1
+		}
+	}
+
+	if !getIdx {
+		return encodeRespBulkString(string(result)), nil
+	}
+
+	return encodeRespArray([][]byte{
+		encodeRespBulkString("matches"),
+		encodeRespArray(matches),
+		encodeRespBulkString("len"),
+		encodeRespInteger(lcsLength),
+	}), nil
+}
+
+// lcsTable returns the table where table[i][j] is the length of the longest
+// common subsequence of a[:i] and b[:j].
+func lcsTable(a string, b string) [][]int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				table[i][j] = table[i-1][j-1] + 1
+			} else {
+				table[i][j] = max(table[i-1][j], table[i][j-1])
+			}
+		}
+	}
+
+	return table
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLCS(t *testing.T) {
+	db := setupTestStore()
+	db.stringStore["a"] = stringEntry{value: "ohmytext"}
+	db.stringStore["b"] = stringEntry{value: "mynewtext"}
+
+	tests := []struct {
+		args []string
+		want []byte
+	}{
+		{[]string{"a", "b"}, encodeRespBulkString("mytext")},
+		{[]string{"a", "b", "LEN"}, encodeRespInteger(6)},
+		{[]string{"a", "missing"}, encodeRespBulkString("")},
+		{[]string{"a", "b", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"}, encodeRespArray([][]byte{
+			encodeRespBulkString("matches"),
+			encodeRespArray([][]byte{
+				encodeRespArray([][]byte{
+					encodeRespIntegerArray([]int{4, 7}),
+					encodeRespIntegerArray([]int{5, 8}),
+					encodeRespInteger(4),
+				}),
+			}),
+			encodeRespBulkString("len"),
+			encodeRespInteger(6),
+		})},
+	}
+
+	for _, tt := range tests {
+		got, err := lcs(db, tt.args)
+		if err != nil {
+			t.Errorf("lcs(%v) error = %v", tt.args, err)
+			continue
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("lcs(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestIncrByOverflowAndTTL(t *testing.T) {
+	db := setupTestStore()
+	expiresAt := time.Now().Add(time.Hour)
+	db.stringStore["n"] = stringEntry{value: "9223372036854775806"}
+	db.expires["n"] = expiresAt
+
+	if _, err := incrby(db, []string{"n", "1"}); err != nil {
+		t.Fatalf("incrby() error = %v", err)
+	}
+
+	if _, err := incr(db, []string{"n"}); err != ErrRespIncrementOverflow {
+		t.Errorf("incr() error = %v, want %v", err, ErrRespIncrementOverflow)
+	}
+
+	if _, err := decrby(db, []string{"n", "-9223372036854775808"}); err != ErrRespDecrementOverflow {
+		t.Errorf("decrby() error = %v, want %v", err, ErrRespDecrementOverflow)
+	}
+
+	if value := db.stringStore["n"].value; value != "9223372036854775807" {
+		t.Errorf("value = %s, want 9223372036854775807", value)
+	}
+
+	if !db.expires["n"].Equal(expiresAt) {
+		t.Errorf("expiresAt = %v, want %v", db.expires["n"], expiresAt)
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	db := setupTestStore()
+
+	tests := []struct {
+		args []string
+		want string
+		err  error
+	}{
+		{[]string{"k", "1", "XX"}, "$-1\r\n", nil},
+		{[]string{"k", "1", "NX"}, "+OK\r\n", nil},
+		{[]string{"k", "2", "NX", "GET"}, "$1\r\n1\r\n", nil},
+		{[]string{"k", "3", "XX", "GET", "EX", "100"}, "$1\r\n1\r\n", nil},
+		{[]string{"k", "4", "KEEPTTL"}, "+OK\r\n", nil},
+		{[]string{"k", "4", "NX", "XX"}, "", ErrRespSyntax},
+		{[]string{"k", "4", "KEEPTTL", "PX", "10"}, "", ErrRespSyntax},
+		{[]string{"k", "4", "EX", "0"}, "", errInvalidExpireTime("set")},
+		{[]string{"k", "4", "UNKNOWN"}, "", ErrRespSyntax},
+	}
+
+	for _, tt := range tests {
+		got, err := set(db, tt.args)
+		if tt.err != nil {
+			if err == nil || err.Error() != tt.err.Error() {
+				t.Errorf("set(%v) error = %v, want %v", tt.args, err, tt.err)
+			}
+			continue
+		}
+
+		if err != nil || string(got) != tt.want {
+			t.Errorf("set(%v) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+
+	if _, ok := db.expires["k"]; db.stringStore["k"].value != "4" || !ok {
+		t.Errorf("k = %q expiring at %v, want 4 with a TTL kept", db.stringStore["k"].value, db.expires["k"])
+	}
+}
+
+func TestMSetAndMGet(t *testing.T) {
+	db := setupTestStore()
+	seedList(db, "l", "a")
+	db.stringStore["ttl"] = stringEntry{value: "old"}
+	db.expires["ttl"] = time.Now().Add(time.Hour)
+
+	if got, _ := mset(db, []string{"a", "1", "b", "2", "a", "3", "l", "4", "ttl", "5"}); string(got) != "+OK\r\n" {
+		t.Fatalf("mset = %q, want OK", got)
+	}
+
+	if _, ok := db.expires["ttl"]; ok {
+		t.Errorf("mset kept the TTL of the key it overwrote")
+	}
+
+	got, _ := mget(db, []string{"a", "b", "missing", "l", "ttl"})
+	want := encodeRespArray([][]byte{
+		encodeRespBulkString("3"),
+		encodeRespBulkString("2"),
+		[]byte("$-1\r\n"),
+		encodeRespBulkString("4"),
+		encodeRespBulkString("5"),
+	})
+	if string(got) != string(want) {
+		t.Errorf("mget = %q, want %q", got, want)
+	}
+
+	if _, err := mset(db, []string{"a", "1", "b"}); err != ErrRespWrongNumberOfArguments {
+		t.Errorf("mset with a missing value error = %v, want %v", err, ErrRespWrongNumberOfArguments)
+	}
+
+	// MGET replies a null for keys holding another type
+	seedList(db, "list", "a")
+	got, _ = mget(db, []string{"list", "a"})
+	want = encodeRespArray([][]byte{[]byte("$-1\r\n"), encodeRespBulkString("3")})
+	if string(got) != string(want) {
+		t.Errorf("mget of a list = %q, want %q", got, want)
+	}
+}
+
+func TestMSetNX(t *testing.T) {
+	db := setupTestStore()
+
+	if got, _ := msetnx(db, []string{"a", "1", "b", "2", "a", "3"}); string(got) != string(encodeRespInteger(1)) {
+		t.Fatalf("msetnx on new keys = %q, want 1", got)
+	}
+
+	got, _ := mget(db, []string{"a", "b"})
+	if want := encodeRespStringArray([]string{"3", "2"}); string(got) != string(want) {
+		t.Errorf("values after msetnx = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name     string
+		existing string
+	}{
+		{"existing string", "b"},
+		{"existing list", "l"},
+	}
+
+	seedList(db, "l", "a")
+	for _, tt := range tests {
+		got, err := msetnx(db, []string{"c", "1", tt.existing, "2"})
+		if err != nil {
+			t.Fatalf("msetnx with an %s error = %v", tt.name, err)
+		}
+
+		if string(got) != string(encodeRespInteger(0)) {
+			t.Errorf("msetnx with an %s = %q, want 0", tt.name, got)
+		}
+
+		if db.keyExists("c") {
+			t.Errorf("msetnx with an %s set the other keys", tt.name)
+		}
+	}
+
+	if keyType := db.lookupKey("l"); keyType != "list" {
+		t.Errorf("type of the list after msetnx = %q, want list", keyType)
+	}
+}
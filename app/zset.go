@@ -0,0 +1,1071 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sortedSet indexes members both by name, for O(1) score lookups, and by
+// score in a skiplist, for O(log n) rank and range queries.
+type sortedSet struct {
+	scores    map[string]float64
+	zsl       *skiplist
+	scanIndex *scanIndex
+}
+
+func newSortedSet() *sortedSet {
+	return &sortedSet{
+		scores:    make(map[string]float64),
+		zsl:       newSkiplist(),
+		scanIndex: newScanIndex(),
+	}
+}
+
+func (z *sortedSet) len() int {
+	return len(z.scores)
+}
+
+// add inserts member or updates its score.
+func (z *sortedSet) add(member string, score float64) {
+	if current, ok := z.scores[member]; ok {
+		if current == score {
+			return
+		}
+
+		z.zsl.delete(current, member)
+	} else {
+		z.scanIndex.insert(member)
+	}
+
+	z.scores[member] = score
+	z.zsl.insert(score, member)
+}
+
+func (z *sortedSet) remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+
+	delete(z.scores, member)
+	z.zsl.delete(score, member)
+	z.scanIndex.remove(member)
+
+	return true
+}
+
+// rank returns the 0-based rank of member, in ascending order unless
+// `reverse` is set.
+func (z *sortedSet) rank(member string, reverse bool) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+
+	rank := z.zsl.rank(score, member)
+	if reverse {
+		return z.len() - rank, true
+	}
+
+	return rank - 1, true
+}
+
+// getSortedSet returns the sorted set stored at key, nil if the key does not
+// exist, or ErrRespWrongType if the key holds another data type.
+func getSortedSet(db database, key string) (*sortedSet, error) {
+	switch db.lookupKey(key) {
+	case "zset":
+		return db.sortedSetStore[key], nil
+	case "none":
+		return nil, nil
+	}
+
+	return nil, ErrRespWrongType
+}
+
+// formatScore formats scores the way Redis replies: integers without a
+// fractional part, infinities as "inf" and "-inf".
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	}
+
+	if math.IsInf(score, -1) {
+		return "-inf"
+	}
+
+	if score == math.Trunc(score) && math.Abs(score) < 1e17 {
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+type scoreRange struct {
+	min          float64
+	max          float64
+	minExclusive bool
+	maxExclusive bool
+}
+
+func (r scoreRange) isEmpty() bool {
+	return r.min > r.max || (r.min == r.max && (r.minExclusive || r.maxExclusive))
+}
+
+func (r scoreRange) aboveMin(n *skiplistNode) bool {
+	if r.minExclusive {
+		return n.score > r.min
+	}
+
+	return n.score >= r.min
+}
+
+func (r scoreRange) belowMax(n *skiplistNode) bool {
+	if r.maxExclusive {
+		return n.score < r.max
+	}
+
+	return n.score <= r.max
+}
+
+// parseScoreBound parses a score such as `1.5`, `(1.5` or `-inf`.
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, ErrRespMinMaxNotFloat
+	}
+
+	return score, exclusive, nil
+}
+
+func parseScoreRange(min string, max string) (scoreRange, error) {
+	var r scoreRange
+	var err error
+
+	r.min, r.minExclusive, err = parseScoreBound(min)
+	if err != nil {
+		return r, err
+	}
+
+	r.max, r.maxExclusive, err = parseScoreBound(max)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+type lexBoundKind int
+
+const (
+	lexBoundValue lexBoundKind = iota
+	lexBoundNegativeInfinity
+	lexBoundPositiveInfinity
+)
+
+type lexBound struct {
+	kind      lexBoundKind
+	value     string
+	exclusive bool
+}
+
+// parseLexBound parses a lexicographical bound such as `[a`, `(a`, `-` or
+// `+`.
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{kind: lexBoundNegativeInfinity}, nil
+	case s == "+":
+		return lexBound{kind: lexBoundPositiveInfinity}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, nil
+	}
+
+	return lexBound{}, ErrRespInvalidLexRange
+}
+
+type lexRange struct {
+	min lexBound
+	max lexBound
+}
+
+func parseLexRange(min string, max string) (lexRange, error) {
+	var r lexRange
+	var err error
+
+	r.min, err = parseLexBound(min)
+	if err != nil {
+		return r, err
+	}
+
+	r.max, err = parseLexBound(max)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func (r lexRange) isEmpty() bool {
+	if r.min.kind == lexBoundPositiveInfinity || r.max.kind == lexBoundNegativeInfinity {
+		return true
+	}
+
+	if r.min.kind != lexBoundValue || r.max.kind != lexBoundValue {
+		return false
+	}
+
+	return r.min.value > r.max.value ||
+		(r.min.value == r.max.value && (r.min.exclusive || r.max.exclusive))
+}
+
+func (r lexRange) aboveMin(n *skiplistNode) bool {
+	switch r.min.kind {
+	case lexBoundNegativeInfinity:
+		return true
+	case lexBoundPositiveInfinity:
+		return false
+	}
+
+	if r.min.exclusive {
+		return n.member > r.min.value
+	}
+
+	return n.member >= r.min.value
+}
+
+func (r lexRange) belowMax(n *skiplistNode) bool {
+	switch r.max.kind {
+	case lexBoundNegativeInfinity:
+		return false
+	case lexBoundPositiveInfinity:
+		return true
+	}
+
+	if r.max.exclusive {
+		return n.member < r.max.value
+	}
+
+	return n.member <= r.max.value
+}
+
+func encodeSortedSetNodes(nodes []*skiplistNode, withScores bool) []byte {
+	elements := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		elements = append(elements, node.member)
+		if withScores {
+			elements = append(elements, formatScore(node.score))
+		}
+	}
+
+	return encodeRespStringArray(elements)
+}
+
+// zadd replies with the number of added members, or of changed members
+// with CH. With INCR, it replies with the new score like ZINCRBY, or a null
+// reply if the update was prevented by NX/XX/GT/LT.
+func zadd(db database, args []string) ([]byte, error) {
+	var nx, xx, gt, lt, ch, incr bool
+
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, ErrRespSyntax
+	}
+
+	if nx && xx {
+		return nil, ErrRespXXAndNX
+	}
+
+	if (gt && lt) || (nx && (gt || lt)) {
+		return nil, ErrRespGTLTAndNX
+	}
+
+	if incr && len(pairs) != 2 {
+		return nil, ErrRespIncrSinglePair
+	}
+
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := parseFloat(pairs[j])
+		if err != nil {
+			return nil, err
+		}
+
+		scores = append(scores, score)
+	}
+
+	z, err := getSortedSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		z = newSortedSet()
+	}
+
+	added := 0
+	changed := 0
+	var incrResult *float64
+
+	for j, score := range scores {
+		member := pairs[2*j+1]
+		current, exists := z.scores[member]
+
+		if (exists && nx) || (!exists && xx) {
+			continue
+		}
+
+		if incr && exists {
+			score += current
+			if math.IsNaN(score) {
+				return nil, ErrRespScoreNaN
+			}
+		}
+
+		if exists && ((gt && score <= current) || (lt && score >= current)) {
+			continue
+		}
+
+		if !exists {
+			added++
+		} else if score != current {
+			changed++
+		}
+
+		z.add(member, score)
+		incrResult = &score
+	}
+
+	if z.len() > 0 && db.sortedSetStore[key] == nil {
+		db.sortedSetStore[key] = z
+		db.keys.insert(key)
+	}
+
+	if added > 0 {
+		signalKeyAsReady(db, key)
+	}
+
+	if incr {
+		if incrResult == nil {
+			return []byte("$-1\r\n"), nil
+		}
+
+		return encodeRespBulkString(formatScore(*incrResult)), nil
+	}
+
+	if ch {
+		return encodeRespInteger(added + changed), nil
+	}
+
+	return encodeRespInteger(added), nil
+}
+
+func zincrby(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	return zadd(db, []string{args[0], "INCR", args[1], args[2]})
+}
+
+func zrem(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	z, err := getSortedSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if z.remove(member) {
+			removed++
+		}
+	}
+
+	if z.len() == 0 {
+		db.deleteKey(key)
+	}
+
+	return encodeRespInteger(removed), nil
+}
+
+func zcard(db database, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	z, err := getSortedSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	return encodeRespInteger(z.len()), nil
+}
+
+func zscore(db database, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	z, err := getSortedSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		return []byte("$-1\r\n"), nil
+	}
+
+	score, ok := z.scores[args[1]]
+	if !ok {
+		return []byte("$-1\r\n"), nil
+	}
+
+	return encodeRespBulkString(formatScore(score)), nil
+}
+
+// zrank handles both ZRANK and ZREVRANK.
+func zrank(db database, args []string, reverse bool) ([]byte, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	withScore := len(args) == 3
+	if withScore && !strings.EqualFold(args[2], "WITHSCORE") {
+		return nil, ErrRespSyntax
+	}
+
+	z, err := getSortedSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var rank int
+	var ok bool
+
+	if z != nil {
+		rank, ok = z.rank(args[1], reverse)
+	}
+
+	if !ok {
+		if withScore {
+			return []byte("*-1\r\n"), nil
+		}
+		return []byte("$-1\r\n"), nil
+	}
+
+	if withScore {
+		return encodeRespArray([][]byte{
+			encodeRespInteger(rank),
+			encodeRespBulkString(formatScore(z.scores[args[1]])),
+		}), nil
+	}
+
+	return encodeRespInteger(rank), nil
+}
+
+// zcount counts members by rank difference between both ends of the range,
+// rather than by walking it.
+func zcount(db database, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := getSortedSet(db, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	first := z.zsl.firstInRange(r)
+	if first == nil {
+		return encodeRespInteger(0), nil
+	}
+
+	last := z.zsl.lastInRange(r)
+
+	return encodeRespInteger(z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1), nil
+}
+
+// zrangeByIndex returns the nodes between inclusive indexes `start` and
+// `stop`, counted from the highest score when `reverse` is set.
+func zrangeByIndex(z *sortedSet, start int, stop int, reverse bool) []*skiplistNode {
+	start, stop, ok := normalizeRange(start, stop, z.len())
+	if !ok {
+		return nil
+	}
+
+	nodes := make([]*skiplistNode, 0, stop-start+1)
+
+	if reverse {
+		node := z.zsl.nodeByRank(z.len() - start)
+		for i := start; i <= stop; i++ {
+			nodes = append(nodes, node)
+			node = node.backward
+		}
+	} else {
+		node := z.zsl.nodeByRank(start + 1)
+		for i := start; i <= stop; i++ {
+			nodes = append(nodes, node)
+			node = node.levels[0].forward
+		}
+	}
+
+	return nodes
+}
+
+// zrangeByRange returns the nodes within `r`, skipping `offset` of them and
+// returning at most `count`, or all of them if `count` is negative.
+func zrangeByRange(z *sortedSet, r skiplistRange, reverse bool, offset int, count int) []*skiplistNode {
+	var node *skiplistNode
+
+	if offset < 0 {
+		return nil
+	}
+
+	if reverse {
+		node = z.zsl.lastInRange(r)
+	} else {
+		node = z.zsl.firstInRange(r)
+	}
+
+	next := func(n *skiplistNode) *skiplistNode {
+		if reverse {
+			return n.backward
+		}
+		return n.levels[0].forward
+	}
+
+	for ; node != nil && offset > 0; offset-- {
+		node = next(node)
+	}
+
+	nodes := make([]*skiplistNode, 0)
+	for node != nil && count != 0 {
+		if (reverse && !r.aboveMin(node)) || (!reverse && !r.belowMax(node)) {
+			break
+		}
+
+		nodes = append(nodes, node)
+		node = next(node)
+		count--
+	}
+
+	return nodes
+}
+
+func zrange(db database, args []string) ([]byte, error) {
+	var byScore, byLex, reverse, withScores, limited bool
+
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	start := args[1]
+	stop := args[2]
+	offset := 0
+	count := -1
+
+	options := args[3:]
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "BYSCORE":
+			byScore = true
+		case "BYLEX":
+			byLex = true
+		case "REV":
+			reverse = true
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(options) {
+				return nil, ErrRespSyntax
+			}
+
+			var err error
+
+			offset, err = parseInteger(options[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			count, err = parseInteger(options[i+2])
+			if err != nil {
+				return nil, err
+			}
+
+			limited = true
+			i += 2
+		default:
+			return nil, ErrRespSyntax
+		}
+	}
+
+	if byScore && byLex {
+		return nil, ErrRespSyntax
+	}
+
+	if limited && !byScore && !byLex {
+		return nil, ErrRespLimitWithoutByScoreOrByLex
+	}
+
+	if withScores && byLex {
+		return nil, ErrRespWithScoresAndByLex
+	}
+
+	// With REV, BYSCORE and BYLEX ranges are given from max to min
+	if reverse && (byScore || byLex) {
+		start, stop = stop, start
+	}
+
+	var r skiplistRange
+	var startIndex, stopIndex int
+	var err error
+
+	if byScore {
+		r, err = parseScoreRange(start, stop)
+	} else if byLex {
+		r, err = parseLexRange(start, stop)
+	} else {
+		startIndex, err = parseInteger(start)
+		if err == nil {
+			stopIndex, err = parseInteger(stop)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := getSortedSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		return []byte("*0\r\n"), nil
+	}
+
+	var nodes []*skiplistNode
+	if r != nil {
+		nodes = zrangeByRange(z, r, reverse, offset, count)
+	} else {
+		nodes = zrangeByIndex(z, startIndex, stopIndex, reverse)
+	}
+
+	return encodeSortedSetNodes(nodes, withScores), nil
+}
+
+// storeSortedSet replaces whatever is stored at key with `z`, deleting the
+// key instead if the sorted set is empty.
+func storeSortedSet(db database, key string, z *sortedSet) {
+	db.deleteKey(key)
+
+	if z.len() > 0 {
+		db.sortedSetStore[key] = z
+		db.keys.insert(key)
+		signalKeyAsReady(db, key)
+	}
+}
+
+// getScoredMembers returns the members and scores of the sorted set stored
+// at key. Members of a plain set all score 1.
+func getScoredMembers(db database, key string) (map[string]float64, error) {
+	switch db.lookupKey(key) {
+	case "zset":
+		return db.sortedSetStore[key].scores, nil
+	case "set":
+		scores := make(map[string]float64, db.setStore[key].len())
+		for _, member := range db.setStore[key].members() {
+			scores[member] = 1
+		}
+
+		return scores, nil
+	case "none":
+		return nil, nil
+	}
+
+	return nil, ErrRespWrongType
+}
+
+type zsetAggregate int
+
+const (
+	zsetAggregateSum zsetAggregate = iota
+	zsetAggregateMin
+	zsetAggregateMax
+)
+
+func (aggregate zsetAggregate) apply(a float64, b float64) float64 {
+	switch aggregate {
+	case zsetAggregateMin:
+		return math.Min(a, b)
+	case zsetAggregateMax:
+		return math.Max(a, b)
+	}
+
+	// inf + -inf
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+
+	return 0
+}
+
+// weightScore multiplies a score by its input weight, 0 * inf being 0.
+func weightScore(score float64, weight float64) float64 {
+	if weighted := score * weight; !math.IsNaN(weighted) {
+		return weighted
+	}
+
+	return 0
+}
+
+// zsetOperationStore implements ZUNIONSTORE, ZINTERSTORE and ZDIFFSTORE:
+// `destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]`,
+// ZDIFFSTORE taking neither WEIGHTS nor AGGREGATE.
+func zsetOperationStore(db database, args []string, operation setOperation, commandName string) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	destination := args[0]
+
+	numKeys, err := parseInteger(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if numKeys <= 0 {
+		return nil, errAtLeastOneInputKey(commandName)
+	}
+
+	if numKeys > len(args)-2 {
+		return nil, ErrRespSyntax
+	}
+
+	keys := args[2 : numKeys+2]
+	options := args[numKeys+2:]
+	aggregate := zsetAggregateSum
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	for i := 0; i < len(options); i++ {
+		if operation == setDifference {
+			return nil, ErrRespSyntax
+		}
+
+		switch strings.ToUpper(options[i]) {
+		case "WEIGHTS":
+			if i+numKeys >= len(options) {
+				return nil, ErrRespSyntax
+			}
+
+			for j := range weights {
+				weights[j], err = strconv.ParseFloat(options[i+1+j], 64)
+				if err != nil || math.IsNaN(weights[j]) {
+					return nil, ErrRespWeightNotFloat
+				}
+			}
+
+			i += numKeys
+		case "AGGREGATE":
+			if i+1 >= len(options) {
+				return nil, ErrRespSyntax
+			}
+
+			switch strings.ToUpper(options[i+1]) {
+			case "SUM":
+				aggregate = zsetAggregateSum
+			case "MIN":
+				aggregate = zsetAggregateMin
+			case "MAX":
+				aggregate = zsetAggregateMax
+			default:
+				return nil, ErrRespSyntax
+			}
+
+			i++
+		default:
+			return nil, ErrRespSyntax
+		}
+	}
+
+	inputs := make([]map[string]float64, 0, numKeys)
+	for _, key := range keys {
+		scores, err := getScoredMembers(db, key)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, scores)
+	}
+
+	result := make(map[string]float64)
+
+	switch operation {
+	case setUnion:
+		for i, input := range inputs {
+			for member, score := range input {
+				score = weightScore(score, weights[i])
+
+				if current, ok := result[member]; ok {
+					result[member] = aggregate.apply(current, score)
+				} else {
+					result[member] = score
+				}
+			}
+		}
+	case setIntersection:
+	members:
+		for member, score := range inputs[0] {
+			score = weightScore(score, weights[0])
+
+			for i, input := range inputs[1:] {
+				other, ok := input[member]
+				if !ok {
+					continue members
+				}
+
+				score = aggregate.apply(score, weightScore(other, weights[i+1]))
+			}
+
+			result[member] = score
+		}
+	case setDifference:
+		for member, score := range inputs[0] {
+			found := false
+			for _, input := range inputs[1:] {
+				if _, ok := input[member]; ok {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				result[member] = score
+			}
+		}
+	}
+
+	z := newSortedSet()
+	for member, score := range result {
+		z.add(member, score)
+	}
+
+	storeSortedSet(db, destination, z)
+
+	return encodeRespInteger(z.len()), nil
+}
+
+func zunionstore(db database, args []string) ([]byte, error) {
+	return zsetOperationStore(db, args, setUnion, "zunionstore")
+}
+
+func zinterstore(db database, args []string) ([]byte, error) {
+	return zsetOperationStore(db, args, setIntersection, "zinterstore")
+}
+
+func zdiffstore(db database, args []string) ([]byte, error) {
+	return zsetOperationStore(db, args, setDifference, "zdiffstore")
+}
+
+// popSortedSet removes and returns up to `count` members with the lowest
+// scores, or the highest ones if `max` is set.
+func popSortedSet(db database, key string, z *sortedSet, max bool, count int) []*skiplistNode {
+	nodes := make([]*skiplistNode, 0, min(count, z.len()))
+
+	for len(nodes) < count && z.len() > 0 {
+		node := z.zsl.header.levels[0].forward
+		if max {
+			node = z.zsl.tail
+		}
+
+		z.remove(node.member)
+		nodes = append(nodes, node)
+	}
+
+	if z.len() == 0 {
+		db.deleteKey(key)
+	}
+
+	return nodes
+}
+
+// zpop handles both ZPOPMIN and ZPOPMAX.
+func zpop(db database, args []string, max bool) ([]byte, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+	count := 1
+
+	if len(args) == 2 {
+		var err error
+
+		count, err = parseInteger(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if count < 0 {
+			return nil, ErrRespValueNotPositive
+		}
+	}
+
+	z, err := getSortedSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		return []byte("*0\r\n"), nil
+	}
+
+	return encodeSortedSetNodes(popSortedSet(db, key, z, max, count), true), nil
+}
+
+// bzpop handles both BZPOPMIN and BZPOPMAX. It is replicated as the
+// ZPOPMIN or ZPOPMAX it ends up doing.
+func bzpop(db database, args []string, max bool, mayBlock bool) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	keys := args[:len(args)-1]
+
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	serve := func(db database, key string) ([]byte, bool) {
+		z, err := getSortedSet(db, key)
+		if err != nil || z == nil {
+			return nil, false
+		}
+
+		node := popSortedSet(db, key, z, max, 1)[0]
+		if max {
+			propagate(db, "ZPOPMAX", key)
+		} else {
+			propagate(db, "ZPOPMIN", key)
+		}
+
+		return encodeRespStringArray([]string{key, node.member, formatScore(node.score)}), true
+	}
+
+	for _, key := range keys {
+		z, err := getSortedSet(db, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if z != nil {
+			reply, _ := serve(db, key)
+			return reply, nil
+		}
+	}
+
+	if !mayBlock {
+		return []byte("*-1\r\n"), nil
+	}
+
+	reply := blockForKeys(db, keys, timeout, serve)
+	if reply == nil {
+		return []byte("*-1\r\n"), nil
+	}
+
+	return reply, nil
+}
+
+func zscan(db database, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, ErrRespWrongNumberOfArguments
+	}
+
+	key := args[0]
+
+	options, err := parseScanOptions(args[1], args[2:], false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := getSortedSet(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if z == nil {
+		return encodeScanReply(0, []string{}), nil
+	}
+
+	members, cursor := scanCollection(options, z.scanIndex)
+
+	elements := make([]string, 0, 2*len(members))
+	for _, member := range members {
+		elements = append(elements, member, formatScore(z.scores[member]))
+	}
+
+	return encodeScanReply(cursor, elements), nil
+}
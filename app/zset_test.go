@@ -0,0 +1,354 @@
+package main
+
+import (
+	"testing"
+)
+
+// zsetMembers returns the members and scores of the sorted set stored at
+// key, by ascending score.
+func zsetMembers(t *testing.T, db database, key string) string {
+	t.Helper()
+
+	got, err := zrange(db, []string{key, "0", "-1", "WITHSCORES"})
+	if err != nil {
+		t.Fatalf("zrange(%s) error = %v", key, err)
+	}
+
+	return string(got)
+}
+
+func TestZAdd(t *testing.T) {
+	db := setupTestStore()
+
+	tests := []struct {
+		args []string
+		want []byte
+		err  error
+		// Members and scores once the command ran
+		members []string
+	}{
+		{args: []string{"z", "1", "a", "2", "b"}, want: encodeRespInteger(2), members: []string{"a", "1", "b", "2"}},
+		{args: []string{"z", "3", "a", "4", "c"}, want: encodeRespInteger(1), members: []string{"b", "2", "a", "3", "c", "4"}},
+		{args: []string{"z", "CH", "3", "a", "5", "b", "1", "d"}, want: encodeRespInteger(2), members: []string{"d", "1", "a", "3", "c", "4", "b", "5"}},
+		{args: []string{"z", "NX", "9", "a", "2", "e"}, want: encodeRespInteger(1), members: []string{"d", "1", "e", "2", "a", "3", "c", "4", "b", "5"}},
+		{args: []string{"z", "XX", "CH", "0", "a", "9", "f"}, want: encodeRespInteger(1), members: []string{"a", "0", "d", "1", "e", "2", "c", "4", "b", "5"}},
+		{args: []string{"z", "GT", "CH", "1", "a", "1", "b", "6", "g"}, want: encodeRespInteger(2), members: []string{"a", "1", "d", "1", "e", "2", "c", "4", "b", "5", "g", "6"}},
+		{args: []string{"z", "LT", "CH", "9", "a", "3", "b"}, want: encodeRespInteger(1), members: []string{"a", "1", "d", "1", "e", "2", "b", "3", "c", "4", "g", "6"}},
+		{args: []string{"z", "INCR", "2.5", "a"}, want: encodeRespBulkString("3.5"), members: []string{"d", "1", "e", "2", "b", "3", "a", "3.5", "c", "4", "g", "6"}},
+		{args: []string{"z", "INCR", "NX", "1", "a"}, want: []byte("$-1\r\n"), members: []string{"d", "1", "e", "2", "b", "3", "a", "3.5", "c", "4", "g", "6"}},
+		{args: []string{"z", "INCR", "GT", "-1", "a"}, want: []byte("$-1\r\n"), members: []string{"d", "1", "e", "2", "b", "3", "a", "3.5", "c", "4", "g", "6"}},
+		{args: []string{"z", "NX", "XX", "1", "a"}, err: ErrRespXXAndNX},
+		{args: []string{"z", "GT", "LT", "1", "a"}, err: ErrRespGTLTAndNX},
+		{args: []string{"z", "NX", "GT", "1", "a"}, err: ErrRespGTLTAndNX},
+		{args: []string{"z", "INCR", "1", "a", "2", "b"}, err: ErrRespIncrSinglePair},
+		{args: []string{"z", "1", "a", "2"}, err: ErrRespSyntax},
+		{args: []string{"z", "x", "a"}, err: ErrRespNotFloat},
+	}
+
+	for _, tt := range tests {
+		got, err := zadd(db, tt.args)
+		if err != tt.err {
+			t.Errorf("zadd(%v) error = %v, want %v", tt.args, err, tt.err)
+			continue
+		}
+
+		if tt.err != nil {
+			continue
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("zadd(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+
+		if members := zsetMembers(t, db, "z"); members != string(encodeRespStringArray(tt.members)) {
+			t.Errorf("members after zadd(%v) = %q, want %v", tt.args, members, tt.members)
+		}
+	}
+
+	// Infinities are valid scores, but not their sum
+	zadd(db, []string{"inf", "+inf", "a"})
+	if _, err := zadd(db, []string{"inf", "INCR", "-inf", "a"}); err != ErrRespScoreNaN {
+		t.Errorf("zadd INCR of -inf to +inf error = %v, want %v", err, ErrRespScoreNaN)
+	}
+
+	// A sorted set left empty by XX is not created
+	zadd(db, []string{"empty", "XX", "1", "a"})
+	if db.keyExists("empty") {
+		t.Errorf("zadd XX created an empty sorted set")
+	}
+}
+
+func TestZIncrBy(t *testing.T) {
+	db := setupTestStore()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"z", "2", "a"}, "2"},
+		{[]string{"z", "-0.5", "a"}, "1.5"},
+		{[]string{"z", "1e3", "b"}, "1000"},
+	}
+
+	for _, tt := range tests {
+		got, err := zincrby(db, tt.args)
+		if err != nil {
+			t.Fatalf("zincrby(%v) error = %v", tt.args, err)
+		}
+
+		if string(got) != string(encodeRespBulkString(tt.want)) {
+			t.Errorf("zincrby(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	if _, err := zincrby(db, []string{"z", "1"}); err != ErrRespWrongNumberOfArguments {
+		t.Errorf("zincrby without a member error = %v, want %v", err, ErrRespWrongNumberOfArguments)
+	}
+}
+
+func TestZRange(t *testing.T) {
+	db := setupTestStore()
+	zadd(db, []string{"z", "1", "a", "2", "b", "2", "c", "3", "d", "4", "e"})
+	zadd(db, []string{"lex", "0", "a", "0", "b", "0", "c", "0", "d", "0", "e"})
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{args: []string{"z", "0", "-1"}, want: []string{"a", "b", "c", "d", "e"}},
+		{args: []string{"z", "1", "2", "WITHSCORES"}, want: []string{"b", "2", "c", "2"}},
+		{args: []string{"z", "-2", "100"}, want: []string{"d", "e"}},
+		{args: []string{"z", "3", "1"}, want: []string{}},
+		{args: []string{"z", "0", "1", "REV"}, want: []string{"e", "d"}},
+		{args: []string{"z", "2", "3", "BYSCORE"}, want: []string{"b", "c", "d"}},
+		{args: []string{"z", "(2", "3", "BYSCORE"}, want: []string{"d"}},
+		{args: []string{"z", "2", "(3", "BYSCORE"}, want: []string{"b", "c"}},
+		{args: []string{"z", "-inf", "+inf", "BYSCORE", "LIMIT", "1", "2"}, want: []string{"b", "c"}},
+		{args: []string{"z", "-inf", "+inf", "BYSCORE", "LIMIT", "4", "-1"}, want: []string{"e"}},
+		{args: []string{"z", "(4", "(1", "BYSCORE", "REV"}, want: []string{"d", "c", "b"}},
+		{args: []string{"z", "+inf", "2", "BYSCORE", "REV", "LIMIT", "0", "2", "WITHSCORES"}, want: []string{"e", "4", "d", "3"}},
+		{args: []string{"z", "(3", "(3", "BYSCORE"}, want: []string{}},
+		{args: []string{"lex", "[b", "(d", "BYLEX"}, want: []string{"b", "c"}},
+		{args: []string{"lex", "-", "+", "BYLEX", "LIMIT", "3", "5"}, want: []string{"d", "e"}},
+		{args: []string{"lex", "+", "(c", "BYLEX", "REV"}, want: []string{"e", "d"}},
+		{args: []string{"missing", "0", "-1"}, want: []string{}},
+		{args: []string{"z", "0", "-1", "LIMIT", "0", "1"}, err: ErrRespLimitWithoutByScoreOrByLex},
+		{args: []string{"lex", "-", "+", "BYLEX", "WITHSCORES"}, err: ErrRespWithScoresAndByLex},
+		{args: []string{"z", "0", "1", "BYSCORE", "BYLEX"}, err: ErrRespSyntax},
+		{args: []string{"z", "x", "1", "BYSCORE"}, err: ErrRespMinMaxNotFloat},
+		{args: []string{"lex", "b", "d", "BYLEX"}, err: ErrRespInvalidLexRange},
+	}
+
+	for _, tt := range tests {
+		got, err := zrange(db, tt.args)
+		if err != tt.err {
+			t.Errorf("zrange(%v) error = %v, want %v", tt.args, err, tt.err)
+			continue
+		}
+
+		if tt.err == nil && string(got) != string(encodeRespStringArray(tt.want)) {
+			t.Errorf("zrange(%v) = %q, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSortedSetReadCommands(t *testing.T) {
+	db := setupTestStore()
+	zadd(db, []string{"z", "1", "a", "2.5", "b", "2.5", "c", "10", "d"})
+
+	zrankFunc := func(reverse bool) func(database, []string) ([]byte, error) {
+		return func(db database, args []string) ([]byte, error) { return zrank(db, args, reverse) }
+	}
+
+	tests := []struct {
+		name string
+		f    func(database, []string) ([]byte, error)
+		args []string
+		want []byte
+	}{
+		{"zcard", zcard, []string{"z"}, encodeRespInteger(4)},
+		{"zcard", zcard, []string{"missing"}, encodeRespInteger(0)},
+		{"zscore", zscore, []string{"z", "b"}, encodeRespBulkString("2.5")},
+		{"zscore", zscore, []string{"z", "missing"}, []byte("$-1\r\n")},
+		{"zrank", zrankFunc(false), []string{"z", "c"}, encodeRespInteger(2)},
+		{"zrank", zrankFunc(false), []string{"z", "missing"}, []byte("$-1\r\n")},
+		{"zrank", zrankFunc(false), []string{"z", "d", "WITHSCORE"}, encodeRespArray([][]byte{encodeRespInteger(3), encodeRespBulkString("10")})},
+		{"zrank", zrankFunc(false), []string{"z", "missing", "WITHSCORE"}, []byte("*-1\r\n")},
+		{"zrevrank", zrankFunc(true), []string{"z", "a"}, encodeRespInteger(3)},
+		{"zcount", zcount, []string{"z", "-inf", "+inf"}, encodeRespInteger(4)},
+		{"zcount", zcount, []string{"z", "2.5", "10"}, encodeRespInteger(3)},
+		{"zcount", zcount, []string{"z", "(2.5", "10"}, encodeRespInteger(1)},
+		{"zcount", zcount, []string{"z", "(1", "(10"}, encodeRespInteger(2)},
+		{"zcount", zcount, []string{"z", "11", "20"}, encodeRespInteger(0)},
+		{"zcount", zcount, []string{"z", "5", "1"}, encodeRespInteger(0)},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.f(db, tt.args)
+		if err != nil {
+			t.Fatalf("%s(%v) error = %v", tt.name, tt.args, err)
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("%s(%v) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestZRem(t *testing.T) {
+	db := setupTestStore()
+	zadd(db, []string{"z", "1", "a", "2", "b"})
+
+	if got, _ := zrem(db, []string{"z", "a", "missing"}); string(got) != string(encodeRespInteger(1)) {
+		t.Errorf("zrem = %q, want 1", got)
+	}
+
+	if got, _ := zrank(db, []string{"z", "b"}, false); string(got) != string(encodeRespInteger(0)) {
+		t.Errorf("zrank after zrem = %q, want 0", got)
+	}
+
+	zrem(db, []string{"z", "b"})
+	if db.keyExists("z") {
+		t.Errorf("sorted set emptied by zrem still exists")
+	}
+}
+
+func TestSortedSetCommandsRejectOtherTypes(t *testing.T) {
+	db := setupTestStore()
+	db.stringStore["str"] = stringEntry{value: "v"}
+
+	tests := []struct {
+		name string
+		f    func() ([]byte, error)
+	}{
+		{"zadd", func() ([]byte, error) { return zadd(db, []string{"str", "1", "a"}) }},
+		{"zrem", func() ([]byte, error) { return zrem(db, []string{"str", "a"}) }},
+		{"zcard", func() ([]byte, error) { return zcard(db, []string{"str"}) }},
+		{"zscore", func() ([]byte, error) { return zscore(db, []string{"str", "a"}) }},
+		{"zrank", func() ([]byte, error) { return zrank(db, []string{"str", "a"}, false) }},
+		{"zcount", func() ([]byte, error) { return zcount(db, []string{"str", "0", "1"}) }},
+		{"zrange", func() ([]byte, error) { return zrange(db, []string{"str", "0", "1"}) }},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.f(); err != ErrRespWrongType {
+			t.Errorf("%s error = %v, want %v", tt.name, err, ErrRespWrongType)
+		}
+	}
+}
+
+func TestSortedSetOperationStores(t *testing.T) {
+	db := setupTestStore()
+	zadd(db, []string{"a", "1", "a", "2", "b", "3", "c"})
+	zadd(db, []string{"b", "10", "b", "20", "c", "30", "d"})
+	sadd(db, []string{"set", "a", "d"})
+	zadd(db, []string{"pos", "+inf", "m"})
+	zadd(db, []string{"neg", "-inf", "m"})
+
+	tests := []struct {
+		name string
+		f    func(database, []string) ([]byte, error)
+		args []string
+		want []string
+	}{
+		{"zunionstore", zunionstore, []string{"2", "a", "b"}, []string{"a", "1", "b", "12", "c", "23", "d", "30"}},
+		{"zunionstore", zunionstore, []string{"2", "a", "b", "WEIGHTS", "2", "1"}, []string{"a", "2", "b", "14", "c", "26", "d", "30"}},
+		{"zunionstore", zunionstore, []string{"2", "a", "b", "AGGREGATE", "MIN"}, []string{"a", "1", "b", "2", "c", "3", "d", "30"}},
+		{"zunionstore", zunionstore, []string{"2", "a", "b", "AGGREGATE", "max", "WEIGHTS", "1", "-1"}, []string{"d", "-30", "a", "1", "b", "2", "c", "3"}},
+		{"zunionstore", zunionstore, []string{"2", "a", "set"}, []string{"d", "1", "a", "2", "b", "2", "c", "3"}},
+		{"zunionstore", zunionstore, []string{"2", "a", "missing"}, []string{"a", "1", "b", "2", "c", "3"}},
+		{"zinterstore", zinterstore, []string{"2", "a", "b"}, []string{"b", "12", "c", "23"}},
+		{"zinterstore", zinterstore, []string{"2", "a", "b", "WEIGHTS", "0.5", "0.1", "AGGREGATE", "MAX"}, []string{"b", "1", "c", "2"}},
+		{"zinterstore", zinterstore, []string{"3", "a", "b", "set"}, []string{}},
+		{"zdiffstore", zdiffstore, []string{"2", "a", "b"}, []string{"a", "1"}},
+		{"zdiffstore", zdiffstore, []string{"2", "b", "set"}, []string{"b", "10", "c", "20"}},
+		// inf * 0 and inf + -inf are 0 rather than NaN
+		{"zunionstore", zunionstore, []string{"1", "pos", "WEIGHTS", "0"}, []string{"m", "0"}},
+		{"zunionstore", zunionstore, []string{"2", "pos", "neg"}, []string{"m", "0"}},
+		{"zinterstore", zinterstore, []string{"2", "pos", "neg"}, []string{"m", "0"}},
+	}
+
+	for _, tt := range tests {
+		// Whatever the destination held is replaced
+		set(db, []string{"dst", "v"})
+
+		got, err := tt.f(db, append([]string{"dst"}, tt.args...))
+		if err != nil {
+			t.Fatalf("%s(%v) error = %v", tt.name, tt.args, err)
+		}
+
+		if string(got) != string(encodeRespInteger(len(tt.want)/2)) {
+			t.Errorf("%s(%v) = %q, want %d", tt.name, tt.args, got, len(tt.want)/2)
+		}
+
+		if len(tt.want) == 0 {
+			if db.keyExists("dst") {
+				t.Errorf("destination of an empty %s(%v) still exists", tt.name, tt.args)
+			}
+			continue
+		}
+
+		if members := zsetMembers(t, db, "dst"); members != string(encodeRespStringArray(tt.want)) {
+			t.Errorf("destination after %s(%v) = %q, want %v", tt.name, tt.args, members, tt.want)
+		}
+	}
+
+	errors := []struct {
+		name string
+		f    func(database, []string) ([]byte, error)
+		args []string
+		err  error
+	}{
+		{"zunionstore", zunionstore, []string{"dst", "0", "a"}, errAtLeastOneInputKey("zunionstore")},
+		{"zunionstore", zunionstore, []string{"dst", "3", "a", "b"}, ErrRespSyntax},
+		{"zunionstore", zunionstore, []string{"dst", "2", "a", "b", "WEIGHTS", "1"}, ErrRespSyntax},
+		{"zunionstore", zunionstore, []string{"dst", "1", "a", "WEIGHTS", "x"}, ErrRespWeightNotFloat},
+		{"zinterstore", zinterstore, []string{"dst", "1", "a", "AGGREGATE", "AVG"}, ErrRespSyntax},
+		{"zdiffstore", zdiffstore, []string{"dst", "1", "a", "WEIGHTS", "1"}, ErrRespSyntax},
+		{"zinterstore", zinterstore, []string{"dst", "2", "a", "dst"}, ErrRespWrongType},
+	}
+
+	set(db, []string{"dst", "v"})
+	for _, tt := range errors {
+		if _, err := tt.f(db, tt.args); err == nil || err.Error() != tt.err.Error() {
+			t.Errorf("%s(%v) error = %v, want %v", tt.name, tt.args, err, tt.err)
+		}
+	}
+}
+
+func TestZPop(t *testing.T) {
+	db := setupTestStore()
+	zadd(db, []string{"z", "1", "a", "2", "b", "3", "c", "4", "d"})
+
+	tests := []struct {
+		args []string
+		max  bool
+		want []string
+	}{
+		{[]string{"z", "2"}, false, []string{"a", "1", "b", "2"}},
+		{[]string{"z"}, true, []string{"d", "4"}},
+		{[]string{"z", "0"}, true, []string{}},
+		{[]string{"z", "5"}, true, []string{"c", "3"}},
+		{[]string{"z"}, false, []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := zpop(db, tt.args, tt.max)
+		if err != nil {
+			t.Fatalf("zpop(%v, max: %t) error = %v", tt.args, tt.max, err)
+		}
+
+		if string(got) != string(encodeRespStringArray(tt.want)) {
+			t.Errorf("zpop(%v, max: %t) = %q, want %v", tt.args, tt.max, got, tt.want)
+		}
+	}
+
+	if db.keyExists("z") {
+		t.Errorf("sorted set emptied by zpop still exists")
+	}
+
+	if _, err := zpop(db, []string{"z", "-1"}, false); err != ErrRespValueNotPositive {
+		t.Errorf("zpop with a negative count error = %v, want %v", err, ErrRespValueNotPositive)
+	}
+}